@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signatureHeader = "X-Webhook-Signature"
+	timestampHeader = "X-Webhook-Timestamp"
+	signaturePrefix = "sha256="
+	// maxSignatureSkew bounds the age of a signed request, so a captured one can't be replayed later
+	maxSignatureSkew = 5 * time.Minute
+	// maxSignedBody bounds the body read into memory to check its signature
+	maxSignedBody = 32 << 20
+)
+
+var errUnauthorized = errors.New("unauthorized")
+
+// webhookAuth authenticates webhook API requests, a request passes with any configured method
+type webhookAuth struct {
+	// BearerToken is expected in "Authorization: Bearer <token>"
+	BearerToken string
+	// HMACSecret signs requests, see signature
+	HMACSecret string
+}
+
+func (a webhookAuth) enabled() bool {
+	return a.BearerToken != "" || a.HMACSecret != ""
+}
+
+// loopbackHost tells if a listener on host is reachable from this host only
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// signature is the hex HMAC-SHA256 of the timestamp, method, request URI and body joined by newlines
+func signature(secret, timestamp, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + uri + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// check tells if r carries the bearer token or a valid signature, the body is restored after reading it
+func (a webhookAuth) check(r *http.Request, now time.Time) error {
+	if a.BearerToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.BearerToken)) == 1 {
+			return nil
+		}
+	}
+	if a.HMACSecret == "" {
+		return errUnauthorized
+	}
+	got, ok := strings.CutPrefix(r.Header.Get(signatureHeader), signaturePrefix)
+	if !ok {
+		return errUnauthorized
+	}
+	timestamp := r.Header.Get(timestampHeader)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errUnauthorized
+	}
+	if skew := now.Sub(time.Unix(sec, 0)); skew > maxSignatureSkew || skew < -maxSignatureSkew {
+		return errUnauthorized
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBody))
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	want := signature(a.HMACSecret, timestamp, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// authMiddleware rejects unauthenticated requests with 401 before they reach the provider
+func authMiddleware(auth webhookAuth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !auth.enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := auth.check(r, time.Now()); err != nil {
+				requestLog(r).WithField(logFieldError, err).Warn("rejected unauthenticated request")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="external-dns-gcore-webhook"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
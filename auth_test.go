@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	auth := webhookAuth{BearerToken: "token", HMACSecret: "secret"}
+	body := `{"Create":[]}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	sign := func(ts, b string) string {
+		return signaturePrefix + signature("secret", ts, http.MethodPost, "/records", []byte(b))
+	}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "no credentials", want: http.StatusUnauthorized},
+		{name: "bearer token", headers: map[string]string{"Authorization": "Bearer token"}, want: http.StatusNoContent},
+		{name: "wrong bearer token", headers: map[string]string{"Authorization": "Bearer other"}, want: http.StatusUnauthorized},
+		{name: "signature", headers: map[string]string{timestampHeader: now, signatureHeader: sign(now, body)}, want: http.StatusNoContent},
+		{name: "signature of another body", headers: map[string]string{timestampHeader: now, signatureHeader: sign(now, "{}")}, want: http.StatusUnauthorized},
+		{name: "expired signature", headers: map[string]string{timestampHeader: old, signatureHeader: sign(old, body)}, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := authMiddleware(auth)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				if b, _ := io.ReadAll(r.Body); string(b) != body {
+					t.Errorf("body after authentication = %q", b)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want || called != (tt.want == http.StatusNoContent) {
+				t.Errorf("status = %d, handler called = %t, want %d", rec.Code, called, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost": true, "127.0.0.1": true, "::1": true, "[::1]": true,
+		"": false, "0.0.0.0": false, "10.0.0.1": false, "webhook.example.com": false,
+	} {
+		if got := loopbackHost(host); got != want {
+			t.Errorf("loopbackHost(%q) = %t, want %t", host, got, want)
+		}
+	}
+}
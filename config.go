@@ -0,0 +1,623 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/G-Core/external-dns-gcore-webhook/gcoreprovider"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	envConfigFile = `CONFIG_FILE`
+	maskedSecret  = `***`
+)
+
+// Config is the effective configuration of the webhook. Values are taken from,
+// in increasing precedence: defaults, the YAML file, environment variables, flags.
+type Config struct {
+	File string `json:"-"`
+
+	APIURL   string
+	APIToken string
+	// APITokenFile replaces APIToken, the file is checked every APITokenFileInterval
+	APITokenFile         string
+	APITokenFileInterval time.Duration
+	// AuthMode is apikey or bearer, APITokenCommand prints a fresh token
+	AuthMode           string
+	APITokenCommand    string
+	TokenRefreshBefore time.Duration
+	APIDebug           bool
+	// Accounts route zones to further Gcore accounts, APIToken is then optional
+	Accounts     []accountConfig
+	DryRun       bool
+	DomainFilter []string
+
+	HTTPProxy               string
+	HTTPCAFile              string
+	HTTPTimeout             time.Duration
+	HTTPDialTimeout         time.Duration
+	HTTPTLSHandshakeTimeout time.Duration
+	HTTPIdleConnTimeout     time.Duration
+	HTTPUserAgent           string
+
+	ServerHost string
+	ServerPort int
+	HealthHost string
+	HealthPort int
+	// ServerTLS serves the webhook API over HTTPS when the certificate and key are set
+	ServerTLS listenerTLS
+	// ServerAuth makes the webhook API reject requests without the token or signature
+	ServerAuth webhookAuth
+
+	LogLevel  string
+	LogFormat string
+
+	ListTimeout      time.Duration
+	ApplyTimeout     time.Duration
+	ApplyQueueLength int
+
+	MaxDeletes      int
+	MaxDeleteShare  float64
+	AllowMassDelete bool
+
+	ProtectedRecords []string
+	ProtectedRefuse  bool
+	ProtectedHide    bool
+
+	SoftDeleteGrace time.Duration
+	SoftDeleteState string
+
+	AuditLog          string
+	AuditLogMaxSizeMB int
+	AuditLogBackups   int
+	DryRunPlanFile    string
+
+	SnapshotDir          string
+	SnapshotBeforeDelete bool
+	SnapshotKeep         int
+
+	Journal     bool
+	JournalSize int
+	JournalFile string
+
+	ReadinessCacheTTL      time.Duration
+	ReadinessMaxRecordsAge time.Duration
+	SelfTest               string
+	TracesExporter         string
+
+	// Tenants are further providers served under /tenants/<name>/
+	Tenants []tenantConfig
+}
+
+func defaultConfig() Config {
+	return Config{
+		APITokenFileInterval:   10 * time.Second,
+		AuthMode:               gcoreprovider.AuthModeAPIKey,
+		TokenRefreshBefore:     time.Minute,
+		HTTPTimeout:            10 * time.Second,
+		HTTPUserAgent:          gcoreprovider.DefaultUserAgent + "/" + Version,
+		ServerHost:             `localhost`,
+		ServerPort:             8888,
+		ServerTLS:              listenerTLS{ReloadInterval: 10 * time.Second},
+		HealthPort:             8080,
+		LogLevel:               `info`,
+		LogFormat:              `text`,
+		ListTimeout:            60 * time.Second,
+		ApplyTimeout:           60 * time.Second,
+		ApplyQueueLength:       5,
+		AuditLogMaxSizeMB:      10,
+		AuditLogBackups:        5,
+		SnapshotKeep:           20,
+		JournalSize:            100,
+		ReadinessCacheTTL:      30 * time.Second,
+		ReadinessMaxRecordsAge: 10 * time.Minute,
+		SelfTest:               gcoreprovider.SelfTestOff,
+		TracesExporter:         gcoreprovider.TracesExporterNone,
+	}
+}
+
+// setting binds a Config field to its YAML key, environment variable and flag
+type setting struct {
+	key    string // dotted YAML path, the flag name is derived from it
+	env    string
+	usage  string
+	secret bool
+	// reload is set for settings applied on SIGHUP without a restart
+	reload bool
+	value  configValue
+}
+
+type configValue interface {
+	Set(string) error
+	String() string
+	yaml() interface{}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "gcore.apiUrl", env: gcoreprovider.EnvAPIURL, usage: "Gcore API base URL", value: (*stringValue)(&c.APIURL)},
+		{key: "gcore.apiToken", reload: true, env: gcoreprovider.EnvAPIToken, usage: "Gcore permanent API token", secret: true, value: (*stringValue)(&c.APIToken)},
+		{key: "gcore.apiTokenFile", env: gcoreprovider.EnvAPITokenFile, usage: "file holding the API token, rotations are picked up", value: (*stringValue)(&c.APITokenFile)},
+		{key: "gcore.apiTokenFileInterval", env: gcoreprovider.EnvAPITokenFileInterval, usage: "how often the token file is checked", value: (*durationValue)(&c.APITokenFileInterval)},
+		{key: "gcore.authMode", env: gcoreprovider.EnvAuthMode, usage: "apikey or bearer", value: (*stringValue)(&c.AuthMode)},
+		{key: "gcore.apiTokenCommand", env: gcoreprovider.EnvAPITokenCommand, usage: "command printing a fresh token", value: (*stringValue)(&c.APITokenCommand)},
+		{key: "gcore.tokenRefreshBefore", env: gcoreprovider.EnvTokenRefreshBefore, usage: "fetch a new JWT this long before it expires", value: (*durationValue)(&c.TokenRefreshBefore)},
+		{key: "gcore.apiDebug", env: gcoreprovider.EnvAPIDebug, usage: "log every Gcore API request at debug level", value: (*boolValue)(&c.APIDebug)},
+		{key: "http.proxy", env: gcoreprovider.EnvHTTPProxy, usage: "proxy of Gcore API requests, HTTPS_PROXY applies when empty", secret: true, value: (*stringValue)(&c.HTTPProxy)},
+		{key: "http.caFile", env: gcoreprovider.EnvCAFile, usage: "PEM bundle trusted in addition to the system roots", value: (*stringValue)(&c.HTTPCAFile)},
+		{key: "http.timeout", env: gcoreprovider.EnvHTTPTimeout, usage: "bound of a single Gcore API request", value: (*durationValue)(&c.HTTPTimeout)},
+		{key: "http.dialTimeout", env: gcoreprovider.EnvDialTimeout, usage: "bound of opening a connection", value: (*durationValue)(&c.HTTPDialTimeout)},
+		{key: "http.tlsHandshakeTimeout", env: gcoreprovider.EnvTLSHandshakeTimeout, usage: "bound of the TLS handshake", value: (*durationValue)(&c.HTTPTLSHandshakeTimeout)},
+		{key: "http.idleConnTimeout", env: gcoreprovider.EnvIdleConnTimeout, usage: "how long idle connections are kept", value: (*durationValue)(&c.HTTPIdleConnTimeout)},
+		{key: "http.userAgent", env: gcoreprovider.EnvUserAgent, usage: "User-Agent of Gcore API requests", value: (*stringValue)(&c.HTTPUserAgent)},
+		{key: "accounts", env: gcoreprovider.EnvAccounts, usage: "YAML list of Gcore accounts owning zones", value: (*accountsValue)(&c.Accounts)},
+		{key: "dryRun", env: `DRY_RUN`, usage: "plan changes without writing them", value: (*boolValue)(&c.DryRun)},
+		{key: "domainFilter", reload: true, env: `DOMAIN_FILTER`, usage: "comma separated domains to manage", value: (*listValue)(&c.DomainFilter)},
+		{key: "server.host", env: `SERVER_HOST`, usage: "address of the webhook API listener", value: (*stringValue)(&c.ServerHost)},
+		{key: "server.port", env: `SERVER_PORT`, usage: "port of the webhook API listener", value: (*intValue)(&c.ServerPort)},
+		{key: "server.tls.certFile", env: `SERVER_TLS_CERT_FILE`, usage: "PEM certificate of the webhook API listener, enables TLS", value: (*stringValue)(&c.ServerTLS.CertFile)},
+		{key: "server.tls.keyFile", env: `SERVER_TLS_KEY_FILE`, usage: "PEM private key of the certificate", value: (*stringValue)(&c.ServerTLS.KeyFile)},
+		{key: "server.tls.clientCAFile", env: `SERVER_TLS_CLIENT_CA_FILE`, usage: "PEM CA bundle, clients must present a certificate it signed", value: (*stringValue)(&c.ServerTLS.ClientCAFile)},
+		{key: "server.tls.reloadInterval", env: `SERVER_TLS_RELOAD_INTERVAL`, usage: "how often the certificate files are checked, 0 disables reloading", value: (*durationValue)(&c.ServerTLS.ReloadInterval)},
+		{key: "server.auth.bearerToken", env: `WEBHOOK_AUTH_TOKEN`, usage: "bearer token required on webhook API requests", secret: true, value: (*stringValue)(&c.ServerAuth.BearerToken)},
+		{key: "server.auth.hmacSecret", env: `WEBHOOK_HMAC_SECRET`, usage: "secret of the " + signatureHeader + " request signature", secret: true, value: (*stringValue)(&c.ServerAuth.HMACSecret)},
+		{key: "health.host", env: `HEALTH_HOST`, usage: "address of the health and metrics listener", value: (*stringValue)(&c.HealthHost)},
+		{key: "health.port", env: `HEALTH_PORT`, usage: "port of the health and metrics listener", value: (*intValue)(&c.HealthPort)},
+		{key: "log.level", reload: true, env: `LOG_LEVEL`, usage: "trace, debug, info, warn or error", value: (*stringValue)(&c.LogLevel)},
+		{key: "log.format", reload: true, env: `LOG_FORMAT`, usage: "text or json", value: (*stringValue)(&c.LogFormat)},
+		{key: "timeouts.list", reload: true, env: gcoreprovider.EnvListTimeout, usage: "bound of listing zones and records", value: (*durationValue)(&c.ListTimeout)},
+		{key: "timeouts.apply", reload: true, env: gcoreprovider.EnvApplyTimeout, usage: "bound of a single apply", value: (*durationValue)(&c.ApplyTimeout)},
+		{key: "applyQueueLength", reload: true, env: gcoreprovider.EnvApplyQueueLength, usage: "applies waiting for a busy zone", value: (*intValue)(&c.ApplyQueueLength)},
+		{key: "deletionLimits.maxDeletes", reload: true, env: gcoreprovider.EnvMaxDeletes, usage: "deleted records per apply, 0 is unlimited", value: (*intValue)(&c.MaxDeletes)},
+		{key: "deletionLimits.maxShare", reload: true, env: gcoreprovider.EnvMaxDeleteShare, usage: "deleted share of a zone, 0 is unlimited", value: (*floatValue)(&c.MaxDeleteShare)},
+		{key: "deletionLimits.allowMassDelete", reload: true, env: gcoreprovider.EnvAllowMassDelete, usage: "ignore deletion limits", value: (*boolValue)(&c.AllowMassDelete)},
+		{key: "protection.records", reload: true, env: gcoreprovider.EnvProtectedRecords, usage: "comma separated <name>[/<type>] never touched", value: (*listValue)(&c.ProtectedRecords)},
+		{key: "protection.refuse", reload: true, env: gcoreprovider.EnvProtectedRefuse, usage: "fail applies touching protected records", value: (*boolValue)(&c.ProtectedRefuse)},
+		{key: "protection.hide", reload: true, env: gcoreprovider.EnvProtectedHide, usage: "hide protected records from external-dns", value: (*boolValue)(&c.ProtectedHide)},
+		{key: "softDelete.grace", env: gcoreprovider.EnvSoftDeleteGrace, usage: "disable deleted records for this long", value: (*durationValue)(&c.SoftDeleteGrace)},
+		{key: "softDelete.stateFile", env: gcoreprovider.EnvSoftDeleteState, usage: "file of disabled records", value: (*stringValue)(&c.SoftDeleteState)},
+		{key: "audit.path", env: gcoreprovider.EnvAuditLog, usage: `JSON-lines audit log, "-" for stdout`, value: (*stringValue)(&c.AuditLog)},
+		{key: "audit.maxSizeMB", env: gcoreprovider.EnvAuditLogMaxSize, usage: "audit log rotation size", value: (*intValue)(&c.AuditLogMaxSizeMB)},
+		{key: "audit.maxBackups", env: gcoreprovider.EnvAuditLogBackups, usage: "rotated audit logs to keep", value: (*intValue)(&c.AuditLogBackups)},
+		{key: "dryRunPlanFile", env: gcoreprovider.EnvDryRunPlanFile, usage: "JSON file with the latest dry-run plan", value: (*stringValue)(&c.DryRunPlanFile)},
+		{key: "snapshots.dir", env: gcoreprovider.EnvSnapshotDir, usage: "directory of zone snapshots", value: (*stringValue)(&c.SnapshotDir)},
+		{key: "snapshots.beforeDelete", env: gcoreprovider.EnvSnapshotBeforeDelete, usage: "snapshot zones before deleting records", value: (*boolValue)(&c.SnapshotBeforeDelete)},
+		{key: "snapshots.keep", env: gcoreprovider.EnvSnapshotKeep, usage: "snapshot files to keep", value: (*intValue)(&c.SnapshotKeep)},
+		{key: "journal.enabled", env: gcoreprovider.EnvJournal, usage: "record applies so they can be undone", value: (*boolValue)(&c.Journal)},
+		{key: "journal.size", env: gcoreprovider.EnvJournalSize, usage: "applies kept in the journal", value: (*intValue)(&c.JournalSize)},
+		{key: "journal.file", env: gcoreprovider.EnvJournalFile, usage: "file of the journal", value: (*stringValue)(&c.JournalFile)},
+		{key: "readiness.cacheTTL", env: gcoreprovider.EnvReadinessCacheTTL, usage: "reuse of the readiness API check", value: (*durationValue)(&c.ReadinessCacheTTL)},
+		{key: "readiness.maxRecordsAge", env: gcoreprovider.EnvReadinessMaxRecordsAge, usage: "longest time without Records, 0 disables", value: (*durationValue)(&c.ReadinessMaxRecordsAge)},
+		{key: "selfTest", env: gcoreprovider.EnvSelfTest, usage: "startup self-test: off, warn or strict", value: (*stringValue)(&c.SelfTest)},
+		{key: "tenants", reload: true, env: `TENANTS`, usage: "YAML list of tenants served under /tenants/<name>/", value: (*tenantsValue)(&c.Tenants)},
+		{key: "tracing.exporter", env: `OTEL_TRACES_EXPORTER`, usage: "none or otlp", value: (*stringValue)(&c.TracesExporter)},
+	}
+}
+
+// flagName turns "deletionLimits.maxDeletes" into "deletion-limits-max-deletes"
+func flagName(key string) string {
+	b := strings.Builder{}
+	for _, r := range key {
+		switch {
+		case r == '.':
+			b.WriteRune('-')
+		case unicode.IsUpper(r):
+			b.WriteRune('-')
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// loadConfig reads the configuration from args, the environment and the file given by
+// --config or CONFIG_FILE. printConfig is set by --print-config.
+func loadConfig(args []string, getenv func(string) string, output io.Writer) (cfg Config, printConfig bool, err error) {
+	cfg = defaultConfig()
+	settings := cfg.settings()
+	fs := flag.NewFlagSet("external-dns-gcore-webhook", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&cfg.File, "config", getenv(envConfigFile), "YAML configuration file, env "+envConfigFile)
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration with secrets masked and exit")
+	flags := map[string]string{}
+	for _, s := range settings {
+		_, isBool := s.value.(*boolValue)
+		fs.Var(&flagValue{key: s.key, flags: flags, isBool: isBool}, flagName(s.key), s.usage+", env "+s.env)
+	}
+	if err = fs.Parse(args); err != nil {
+		return cfg, false, err
+	}
+	if cfg.File != "" {
+		if err = cfg.loadFile(cfg.File, settings); err != nil {
+			return cfg, printConfig, err
+		}
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err = s.value.Set(v); err != nil {
+				return cfg, printConfig, fmt.Errorf("env %s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.key]; ok {
+			if err = s.value.Set(v); err != nil {
+				return cfg, printConfig, fmt.Errorf("flag --%s: %w", flagName(s.key), err)
+			}
+		}
+	}
+	return cfg, printConfig, cfg.validate()
+}
+
+func (c *Config) loadFile(file string, settings []setting) error {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	raw := yaml.MapSlice{}
+	if err = yaml.Unmarshal(bs, &raw); err != nil {
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+	values := map[string]interface{}{}
+	flatten("", raw, values)
+	byKey := map[string]setting{}
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s, ok := byKey[k]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key %q", file, k)
+		}
+		if err = s.value.Set(yamlString(values[k])); err != nil {
+			return fmt.Errorf("config file %s: %s: %w", file, k, err)
+		}
+	}
+	return nil
+}
+
+// flatten turns nested mappings into dotted keys
+func flatten(prefix string, m yaml.MapSlice, res map[string]interface{}) {
+	for _, item := range m {
+		key := fmt.Sprint(item.Key)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := item.Value.(yaml.MapSlice); ok {
+			flatten(key, nested, res)
+			continue
+		}
+		res[key] = item.Value
+	}
+}
+
+// yamlString turns a file value into the text of a flag: lists of scalars are joined
+// with commas, lists of mappings are marshaled back to YAML.
+func yamlString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.(yaml.MapSlice); ok {
+				bs, _ := yaml.Marshal(v)
+				return string(bs)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func (c *Config) validate() error {
+	errs := make([]error, 0)
+	sources := 0
+	for _, v := range []string{c.APIToken, c.APITokenFile, c.APITokenCommand} {
+		if v != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0 && len(c.Accounts) == 0 && len(c.Tenants) == 0:
+		errs = append(errs, fmt.Errorf("gcore.apiToken (env %s), gcore.apiTokenFile (env %s) or gcore.apiTokenCommand (env %s) is required",
+			gcoreprovider.EnvAPIToken, gcoreprovider.EnvAPITokenFile, gcoreprovider.EnvAPITokenCommand))
+	case sources > 1:
+		errs = append(errs, fmt.Errorf("gcore.apiToken, gcore.apiTokenFile and gcore.apiTokenCommand are mutually exclusive"))
+	}
+	names := map[string]bool{gcoreprovider.DefaultAccount: sources > 0}
+	for i, a := range c.Accounts {
+		if a.Name == "" || names[a.Name] {
+			errs = append(errs, fmt.Errorf("accounts[%d]: name %q is empty or used twice", i, a.Name))
+		}
+		names[a.Name] = true
+		if (a.Token == "") == (a.TokenFile == "") {
+			errs = append(errs, fmt.Errorf("accounts[%d]: exactly one of token and tokenFile is required", i))
+		}
+	}
+	errs = append(errs, c.validateTenants()...)
+	if !oneOf(c.AuthMode, gcoreprovider.AuthModeAPIKey, gcoreprovider.AuthModeBearer) {
+		errs = append(errs, fmt.Errorf("gcore.authMode: %q is not apikey or bearer", c.AuthMode))
+	}
+	for key, port := range map[string]int{"server.port": c.ServerPort, "health.port": c.HealthPort} {
+		if port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s: %d is not a valid port", key, port))
+		}
+	}
+	if (c.ServerTLS.CertFile == "") != (c.ServerTLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("server.tls.certFile and server.tls.keyFile must be set together"))
+	}
+	if c.SoftDeleteGrace > 0 && c.SoftDeleteState == "" {
+		errs = append(errs, fmt.Errorf("softDelete.grace requires softDelete.stateFile (env %s)", gcoreprovider.EnvSoftDeleteState))
+	}
+	if c.ServerTLS.ClientCAFile != "" && c.ServerTLS.CertFile == "" {
+		errs = append(errs, fmt.Errorf("server.tls.clientCAFile requires server.tls.certFile"))
+	}
+	if c.ServerPort == c.HealthPort && sharedHost(c.ServerHost, c.HealthHost) {
+		errs = append(errs, fmt.Errorf("server and health listeners must not share %s:%d", c.ServerHost, c.ServerPort))
+	}
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if !oneOf(c.LogFormat, `text`, `json`, `auto`) {
+		errs = append(errs, fmt.Errorf("log.format: %q is not text or json", c.LogFormat))
+	}
+	for key, d := range map[string]time.Duration{
+		"gcore.apiTokenFileInterval": c.APITokenFileInterval, "gcore.tokenRefreshBefore": c.TokenRefreshBefore,
+		"http.timeout": c.HTTPTimeout, "http.dialTimeout": c.HTTPDialTimeout,
+		"http.tlsHandshakeTimeout": c.HTTPTLSHandshakeTimeout, "http.idleConnTimeout": c.HTTPIdleConnTimeout, "timeouts.list": c.ListTimeout, "timeouts.apply": c.ApplyTimeout, "softDelete.grace": c.SoftDeleteGrace,
+		"server.tls.reloadInterval": c.ServerTLS.ReloadInterval, "readiness.cacheTTL": c.ReadinessCacheTTL, "readiness.maxRecordsAge": c.ReadinessMaxRecordsAge,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", key))
+		}
+	}
+	for key, n := range map[string]int{
+		"applyQueueLength": c.ApplyQueueLength, "deletionLimits.maxDeletes": c.MaxDeletes,
+		"audit.maxSizeMB": c.AuditLogMaxSizeMB, "audit.maxBackups": c.AuditLogBackups,
+		"snapshots.keep": c.SnapshotKeep, "journal.size": c.JournalSize,
+	} {
+		if n < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", key))
+		}
+	}
+	if c.MaxDeleteShare < 0 || c.MaxDeleteShare > 1 {
+		errs = append(errs, fmt.Errorf("deletionLimits.maxShare: %v is not between 0 and 1", c.MaxDeleteShare))
+	}
+	if _, err := gcoreprovider.NewProtectionRules(c.ProtectedRecords); err != nil {
+		errs = append(errs, fmt.Errorf("protection.records: %w", err))
+	}
+	if !oneOf(c.SelfTest, gcoreprovider.SelfTestOff, gcoreprovider.SelfTestWarn, gcoreprovider.SelfTestStrict) {
+		errs = append(errs, fmt.Errorf("selfTest: %q is not off, warn or strict", c.SelfTest))
+	}
+	if !oneOf(c.TracesExporter, gcoreprovider.TracesExporterNone, gcoreprovider.TracesExporterOTLP) {
+		errs = append(errs, fmt.Errorf("tracing.exporter: %q is not none or otlp", c.TracesExporter))
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// restartRequired lists the keys changed in next which a reload does not apply
+func (c *Config) restartRequired(next Config) []string {
+	res := make([]string, 0)
+	nextSettings := next.settings()
+	for i, s := range c.settings() {
+		if !s.reload && s.value.String() != nextSettings[i].value.String() {
+			res = append(res, s.key)
+		}
+	}
+	return res
+}
+
+// applyReloadable copies the settings applied on SIGHUP from next, the others keep their values
+func (c *Config) applyReloadable(next Config) {
+	nextSettings := next.settings()
+	for i, s := range c.settings() {
+		if s.reload {
+			reflect.ValueOf(s.value).Elem().Set(reflect.ValueOf(nextSettings[i].value).Elem())
+		}
+	}
+}
+
+// print writes the effective configuration as YAML, secrets are masked
+func (c *Config) print(w io.Writer) error {
+	root := yaml.MapSlice{}
+	for _, s := range c.settings() {
+		v := s.value.yaml()
+		if s.secret && s.value.String() != "" {
+			v = maskedSecret
+		}
+		root = insert(root, strings.Split(s.key, "."), v)
+	}
+	bs, err := yaml.Marshal(root)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+func insert(m yaml.MapSlice, path []string, v interface{}) yaml.MapSlice {
+	if len(path) == 1 {
+		return append(m, yaml.MapItem{Key: path[0], Value: v})
+	}
+	for i, item := range m {
+		if item.Key == path[0] {
+			m[i].Value = insert(item.Value.(yaml.MapSlice), path[1:], v)
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: path[0], Value: insert(yaml.MapSlice{}, path[1:], v)})
+}
+
+// sharedHost tells if listeners on a and b with the same port collide, a wildcard address takes every host
+func sharedHost(a, b string) bool {
+	return a == b || oneOf(a, "", "0.0.0.0", "::", "[::]") || oneOf(b, "", "0.0.0.0", "::", "[::]")
+}
+
+func oneOf(v string, values ...string) bool {
+	for _, value := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// flagValue collects a flag so it is applied after the file and the environment
+type flagValue struct {
+	key    string
+	flags  map[string]string
+	isBool bool
+}
+
+func (v *flagValue) Set(s string) error { v.flags[v.key] = s; return nil }
+func (v *flagValue) String() string     { return "" }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) yaml() interface{}  { return string(*v) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a boolean", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string    { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) yaml() interface{} { return bool(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string    { return strconv.Itoa(int(*v)) }
+func (v *intValue) yaml() interface{} { return int(*v) }
+
+type floatValue float64
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+func (v *floatValue) String() string    { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+func (v *floatValue) yaml() interface{} { return float64(*v) }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%q is not a duration like 90s or 5m", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string    { return time.Duration(*v).String() }
+func (v *durationValue) yaml() interface{} { return time.Duration(*v).String() }
+
+type listValue []string
+
+func (v *listValue) Set(s string) error {
+	*v = (*v)[:0]
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v = append(*v, item)
+		}
+	}
+	return nil
+}
+func (v *listValue) String() string { return strings.Join(*v, ",") }
+func (v *listValue) yaml() interface{} {
+	if *v == nil {
+		return []string{}
+	}
+	return []string(*v)
+}
+
+// accountConfig is an entry of the accounts list
+type accountConfig struct {
+	Name      string   `yaml:"name"`
+	APIURL    string   `yaml:"apiUrl,omitempty"`
+	Token     string   `yaml:"token,omitempty"`
+	TokenFile string   `yaml:"tokenFile,omitempty"`
+	Zones     []string `yaml:"zones,omitempty"`
+}
+
+// accountsValue is set from a YAML or JSON list, tokens are masked when printed
+type accountsValue []accountConfig
+
+func (v *accountsValue) Set(s string) error {
+	accounts := make([]accountConfig, 0)
+	if err := yaml.UnmarshalStrict([]byte(s), &accounts); err != nil {
+		return fmt.Errorf("not a list of accounts: %w", err)
+	}
+	*v = accounts
+	return nil
+}
+func (v *accountsValue) String() string {
+	if len(*v) == 0 {
+		return ""
+	}
+	bs, _ := yaml.Marshal([]accountConfig(*v))
+	return string(bs)
+}
+func (v *accountsValue) yaml() interface{} {
+	res := make([]accountConfig, 0, len(*v))
+	for _, a := range *v {
+		if a.Token != "" {
+			a.Token = maskedSecret
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+func (v accountsValue) options() []gcoreprovider.AccountConfig {
+	res := make([]gcoreprovider.AccountConfig, 0, len(v))
+	for _, a := range v {
+		res = append(res, gcoreprovider.AccountConfig{
+			Name:      a.Name,
+			APIURL:    a.APIURL,
+			Token:     a.Token,
+			TokenFile: a.TokenFile,
+			Zones:     a.Zones,
+		})
+	}
+	return res
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig_precedence(t *testing.T) {
+	file := writeConfigFile(t, `
+gcore:
+  apiToken: from-file
+domainFilter: [a.com, b.com]
+server:
+  port: 7000
+timeouts:
+  list: 2m
+deletionLimits:
+  maxShare: 0.5
+`)
+	env := map[string]string{
+		"CONFIG_FILE":        file,
+		"SERVER_PORT":        "7001",
+		"GCORE_LIST_TIMEOUT": "3m",
+		"HEALTH_HOST":        "",
+	}
+	cfg, _, err := loadConfig([]string{"--server-port", "7002"}, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIToken != "from-file" || cfg.ServerPort != 7002 || cfg.ListTimeout != 3*time.Minute {
+		t.Errorf("unexpected precedence: %+v", cfg)
+	}
+	if strings.Join(cfg.DomainFilter, ",") != "a.com,b.com" || cfg.MaxDeleteShare != 0.5 {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.HealthPort != 8080 || cfg.ApplyQueueLength != 5 {
+		t.Errorf("defaults not kept: %+v", cfg)
+	}
+}
+
+func TestLoadConfig_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "missing token", want: "gcore.apiToken (env GCORE_PERMANENT_API_TOKEN), gcore.apiTokenFile"},
+		{name: "token and token file", args: []string{"--gcore-api-token-file", "/token"}, want: "mutually exclusive"},
+		{name: "bad auth mode", args: []string{"--gcore-auth-mode", "basic"}, want: `gcore.authMode: "basic"`},
+		{name: "unknown file key", file: "gcore:\n  apiKey: x\n", want: `unknown key "gcore.apiKey"`},
+		{name: "bad env", env: map[string]string{"GCORE_MAX_DELETES": "many"}, want: "env GCORE_MAX_DELETES"},
+		{name: "bad flag", args: []string{"--applyQueueLength=x"}, want: "flag provided but not defined"},
+		{name: "bad port", args: []string{"--server-port", "70000"}, want: "server.port: 70000 is not a valid port"},
+		{name: "shared listener", args: []string{"--server-host", "127.0.0.1", "--health-host", "127.0.0.1", "--health-port", "8888"}, want: "must not share 127.0.0.1:8888"},
+		{name: "wildcard health listener", args: []string{"--server-host", "localhost", "--health-host", "0.0.0.0", "--health-port", "8888"}, want: "must not share localhost:8888"},
+		{name: "empty server host", args: []string{"--server-host", "", "--health-host", "10.0.0.1", "--health-port", "8888"}, want: "must not share :8888"},
+		{name: "soft delete without state", env: map[string]string{"GCORE_SOFT_DELETE_GRACE": "24h"}, want: "softDelete.grace requires softDelete.stateFile"},
+		{name: "bad share", args: []string{"--deletion-limits-max-share", "2"}, want: "deletionLimits.maxShare"},
+		{name: "account without token", env: map[string]string{"GCORE_ACCOUNTS": "[{name: a}]"}, want: "accounts[0]: exactly one of token and tokenFile"},
+		{name: "default account twice", env: map[string]string{"GCORE_ACCOUNTS": `[{name: default, token: x}]`}, want: `accounts[0]: name "default"`},
+		{name: "tls cert without key", args: []string{"--server-tls-cert-file", "/tls.crt"}, want: "server.tls.certFile and server.tls.keyFile"},
+		{name: "bad self-test", args: []string{"--self-test", "maybe"}, want: `selfTest: "maybe"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			if tt.file != "" {
+				env["CONFIG_FILE"] = writeConfigFile(t, tt.file)
+			}
+			if tt.name != "missing token" {
+				env["GCORE_PERMANENT_API_TOKEN"] = "token"
+			}
+			_, _, err := loadConfig(tt.args, envMap(env), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_accounts(t *testing.T) {
+	file := writeConfigFile(t, `
+accounts:
+  - name: prod
+    token: prod-token
+    zones: [example.com]
+  - name: staging
+    tokenFile: /run/staging
+`)
+	cfg, _, err := loadConfig([]string{"--config", file}, envMap(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Accounts) != 2 || cfg.Accounts[0].Token != "prod-token" || cfg.Accounts[0].Zones[0] != "example.com" ||
+		cfg.Accounts[1].TokenFile != "/run/staging" {
+		t.Errorf("accounts = %+v", cfg.Accounts)
+	}
+	buf := &bytes.Buffer{}
+	if err = cfg.print(buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "prod-token") || !strings.Contains(out, "name: staging") {
+		t.Errorf("accounts not printed with tokens masked:\n%s", out)
+	}
+}
+
+func TestConfig_print(t *testing.T) {
+	cfg, printConfig, err := loadConfig([]string{"--print-config", "--gcore-api-token", "secret-token"}, envMap(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !printConfig {
+		t.Error("--print-config not set")
+	}
+	buf := &bytes.Buffer{}
+	if err = cfg.print(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret-token") || !strings.Contains(out, "apiToken: '***'") {
+		t.Errorf("token not masked:\n%s", out)
+	}
+	file := writeConfigFile(t, out)
+	reloaded, _, err := loadConfig([]string{"--config", file, "--gcore-api-token", "secret-token"}, envMap(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("printed configuration does not load: %v", err)
+	}
+	if reloaded.ServerPort != cfg.ServerPort || reloaded.ListTimeout != cfg.ListTimeout {
+		t.Errorf("printed configuration differs: %+v", reloaded)
+	}
+}
+
+func TestConfig_restartRequired(t *testing.T) {
+	env := map[string]string{"GCORE_PERMANENT_API_TOKEN": "token"}
+	started, _, err := loadConfig(nil, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, _, err := loadConfig([]string{"--log-level", "debug", "--server-port", "9000",
+		"--domain-filter", "example.com", "--journal-enabled"}, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(started.restartRequired(next), ","); got != "server.port,journal.enabled" {
+		t.Errorf("restartRequired() = %s", got)
+	}
+
+	// reloadable settings are taken over, the others keep their startup values
+	started.applyReloadable(next)
+	if started.LogLevel != "debug" || !reflect.DeepEqual(started.DomainFilter, []string{"example.com"}) {
+		t.Errorf("applyReloadable() kept log level %s, domain filter %v", started.LogLevel, started.DomainFilter)
+	}
+	if started.ServerPort == next.ServerPort || started.Journal {
+		t.Errorf("applyReloadable() changed settings requiring a restart: %+v", started)
+	}
+	if got := strings.Join(started.restartRequired(next), ","); got != "server.port,journal.enabled" {
+		t.Errorf("restartRequired() after applyReloadable() = %s", got)
+	}
+}
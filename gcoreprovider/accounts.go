@@ -0,0 +1,357 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// DefaultAccount is the name of the account of GCORE_PERMANENT_API_TOKEN when accounts are configured
+const DefaultAccount = "default"
+
+var (
+	// ErrAmbiguousZone is returned when more than one account could own a zone
+	ErrAmbiguousZone = errors.New("zone is claimed by more than one account")
+	// ErrNoAccount is returned when no account owns a zone
+	ErrNoAccount = errors.New("no account owns the zone")
+)
+
+// AccountConfig is a Gcore account owning a part of the managed zones
+type AccountConfig struct {
+	Name string
+	// APIURL is the API of the account, the API URL of the provider when empty
+	APIURL string
+	Token  string
+	// TokenFile is read at startup and again when the API rejects the token, it is not polled
+	TokenFile string
+	// Zones are the domains owned by the account, subdomains included. An account without
+	// zones owns the zones it lists unless another account claims them explicitly.
+	Zones []string
+}
+
+type account struct {
+	name   string
+	client dnsManager
+	zones  endpoint.DomainFilter
+}
+
+// claims tells if the zones of the account explicitly select zone
+func (a *account) claims(zone string) bool {
+	return a.zones.IsConfigured() && a.zones.Match(zone)
+}
+
+// accountRouter is a dnsManager sending every call to the account owning the zone,
+// listings are merged from all accounts.
+type accountRouter struct {
+	accounts []*account
+	mu       sync.Mutex
+	// owners caches zones found by listing accounts without configured zones
+	owners map[string]*account
+}
+
+func newAccountRouter(accounts ...*account) *accountRouter {
+	return &accountRouter{accounts: accounts, owners: map[string]*account{}}
+}
+
+// newAccounts creates a client per configured account, def is the client of the provider token or nil.
+// Accounts without their own API URL use apiUrl.
+func (p *DnsProvider) newAccounts(def dnsManager, apiUrl string) (*accountRouter, error) {
+	accounts := make([]*account, 0, len(p.accounts)+1)
+	if def != nil {
+		accounts = append(accounts, &account{name: DefaultAccount, client: def})
+	}
+	seen := map[string]bool{DefaultAccount: def != nil}
+	for _, cfg := range p.accounts {
+		if cfg.Name == "" || seen[cfg.Name] {
+			return nil, fmt.Errorf("%s: account name %q is empty or used twice", ProviderName, cfg.Name)
+		}
+		seen[cfg.Name] = true
+		c, err := p.newAccountClient(cfg, apiUrl)
+		if err != nil {
+			return nil, fmt.Errorf("%s: account %s: %w", ProviderName, cfg.Name, err)
+		}
+		accounts = append(accounts, &account{name: cfg.Name, client: c, zones: endpoint.NewDomainFilter(cfg.Zones)})
+		log.Infof("%s: account %s: zones=%v", ProviderName, cfg.Name, cfg.Zones)
+	}
+	return newAccountRouter(accounts...), nil
+}
+
+func (p *DnsProvider) newAccountClient(cfg AccountConfig, apiUrl string) (*gdns.Client, error) {
+	token := cfg.Token
+	if cfg.TokenFile != "" {
+		if token != "" {
+			return nil, errors.New("token and token file are mutually exclusive")
+		}
+		var err error
+		if token, err = readTokenFile(cfg.TokenFile); err != nil {
+			return nil, err
+		}
+	}
+	if token == "" {
+		return nil, errors.New("empty token")
+	}
+	p.addSecret(token)
+	creds := newCredentials(token)
+	creds.setScheme(p.auth.scheme())
+	var refresh func(ctx context.Context, rejected string) error
+	if cfg.TokenFile != "" {
+		refresh = func(_ context.Context, rejected string) error {
+			creds.refreshMu.Lock()
+			defer creds.refreshMu.Unlock()
+			if creds.get() != rejected {
+				return nil
+			}
+			token, err := readTokenFile(cfg.TokenFile)
+			if err != nil {
+				creds.checked(time.Now(), err)
+				return err
+			}
+			p.addSecret(token)
+			if !creds.set(token) {
+				return ErrTokenUnchanged
+			}
+			creds.loaded(time.Now())
+			log.Infof("%s: account %s: API token reloaded from %s", ProviderName, cfg.Name, cfg.TokenFile)
+			return nil
+		}
+	}
+	c := gdns.NewClient(gdns.PermanentAPIKeyAuth(token))
+	if cfg.APIURL != "" {
+		apiUrl = cfg.APIURL
+	}
+	if apiUrl != "" {
+		if _, err := setClientBaseURL(c, apiUrl); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.setupClient(c, creds, refresh); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// owner finds the account of zone: the single account claiming it by its zones,
+// otherwise the single account without zones listing it.
+func (r *accountRouter) owner(ctx context.Context, zone string) (*account, error) {
+	zone = normalizeName(zone)
+	claimed := make([]*account, 0, 1)
+	for _, a := range r.accounts {
+		if a.claims(zone) {
+			claimed = append(claimed, a)
+		}
+	}
+	if len(claimed) > 0 {
+		return single(zone, claimed)
+	}
+	r.mu.Lock()
+	a, ok := r.owners[zone]
+	r.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+	listing := make([]*account, 0, 1)
+	for _, a := range r.accounts {
+		if a.zones.IsConfigured() {
+			continue
+		}
+		res, err := a.client.ZonesWithParam(ctx, gdns.ZonesParam{Name: []string{zone}, ExactMatch: true})
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", a.name, err)
+		}
+		for _, z := range res.Zones {
+			if normalizeName(z.Name) == zone {
+				listing = append(listing, a)
+				break
+			}
+		}
+	}
+	a, err := single(zone, listing)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.owners[zone] = a
+	r.mu.Unlock()
+	return a, nil
+}
+
+func single(zone string, candidates []*account) (*account, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%s: %w", zone, ErrNoAccount)
+	case 1:
+		return candidates[0], nil
+	}
+	names := make([]string, 0, len(candidates))
+	for _, a := range candidates {
+		names = append(names, a.name)
+	}
+	return nil, fmt.Errorf("%s: %w: %s", zone, ErrAmbiguousZone, strings.Join(names, ", "))
+}
+
+// AllZonesWithRecords merges the zones of all accounts, a zone is taken only from its owner.
+// A zone owned by several accounts is logged and left out instead of mixing their records,
+// changes to it still fail in owner.
+func (r *accountRouter) AllZonesWithRecords(ctx context.Context, nameFilters []string) ([]gdns.Zone, error) {
+	listed := make([][]gdns.Zone, len(r.accounts))
+	gr, grCtx := errgroup.WithContext(ctx)
+	for i, a := range r.accounts {
+		i, a := i, a
+		gr.Go(func() error {
+			zs, err := a.client.AllZonesWithRecords(grCtx, nameFilters)
+			if err != nil {
+				return fmt.Errorf("account %s: %w", a.name, err)
+			}
+			listed[i] = zs
+			return nil
+		})
+	}
+	if err := gr.Wait(); err != nil {
+		return nil, err
+	}
+	owners := map[string][]*account{}
+	zones := map[string]gdns.Zone{}
+	order := make([]string, 0)
+	for i, a := range r.accounts {
+		for _, z := range listed[i] {
+			name := normalizeName(z.Name)
+			if !r.owns(a, name) {
+				continue
+			}
+			if _, ok := zones[name]; !ok {
+				order = append(order, name)
+			}
+			owners[name] = append(owners[name], a)
+			zones[name] = z
+		}
+	}
+	res := make([]gdns.Zone, 0, len(order))
+	for _, name := range order {
+		a, err := single(name, owners[name])
+		if err != nil {
+			log.Errorf("%s: skipping zone: %v", ProviderName, err)
+			continue
+		}
+		if !a.zones.IsConfigured() {
+			r.mu.Lock()
+			r.owners[name] = a
+			r.mu.Unlock()
+		}
+		res = append(res, zones[name])
+	}
+	return res, nil
+}
+
+// owns tells if a listed zone belongs to a: claimed by it, or unclaimed by all and a lists everything
+func (r *accountRouter) owns(a *account, zone string) bool {
+	if a.zones.IsConfigured() {
+		return a.claims(zone)
+	}
+	for _, other := range r.accounts {
+		if other.claims(zone) {
+			return false
+		}
+	}
+	return true
+}
+
+// ZonesWithParam pages the accounts one after another as a single listing:
+// Offset skips the zones of earlier accounts by their TotalAmount and Limit
+// spans account boundaries, accounts past the page are only counted.
+func (r *accountRouter) ZonesWithParam(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+	res := gdns.ListZones{}
+	offset, remaining := param.Offset, param.Limit
+	for _, a := range r.accounts {
+		query := param
+		query.Offset = offset
+		full := param.Limit > 0 && remaining == 0
+		if param.Limit > 0 {
+			query.Limit = remaining
+		}
+		if full {
+			query.Offset, query.Limit = 0, 1
+		}
+		zs, err := a.client.ZonesWithParam(ctx, query)
+		if err == nil && zs.Error != "" {
+			err = errors.New(zs.Error)
+		}
+		if err != nil {
+			return gdns.ListZones{}, fmt.Errorf("account %s: %w", a.name, err)
+		}
+		res.TotalAmount += zs.TotalAmount
+		if full {
+			continue
+		}
+		res.Zones = append(res.Zones, zs.Zones...)
+		offset -= min(offset, uint64(zs.TotalAmount))
+		if param.Limit > 0 {
+			remaining -= min(remaining, uint64(len(zs.Zones)))
+		}
+	}
+	return res, nil
+}
+
+func (r *accountRouter) AddZoneRRSet(ctx context.Context, zone, recordName, recordType string,
+	values []gdns.ResourceRecord, ttl int, opts ...gdns.AddZoneOpt) error {
+	a, err := r.owner(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return accountError(a, a.client.AddZoneRRSet(ctx, zone, recordName, recordType, values, ttl, opts...))
+}
+
+func (r *accountRouter) CreateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	a, err := r.owner(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return accountError(a, a.client.CreateRRSet(ctx, zone, name, recordType, record))
+}
+
+func (r *accountRouter) DeleteRRSet(ctx context.Context, zone, name, recordType string) error {
+	a, err := r.owner(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return accountError(a, a.client.DeleteRRSet(ctx, zone, name, recordType))
+}
+
+func (r *accountRouter) DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error {
+	a, err := r.owner(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return accountError(a, a.client.DeleteRRSetRecord(ctx, zone, name, recordType, contents...))
+}
+
+func (r *accountRouter) RRSet(ctx context.Context, zone, name, recordType string) (gdns.RRSet, error) {
+	a, err := r.owner(ctx, zone)
+	if err != nil {
+		return gdns.RRSet{}, err
+	}
+	res, err := a.client.RRSet(ctx, zone, name, recordType)
+	return res, accountError(a, err)
+}
+
+func (r *accountRouter) UpdateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	a, err := r.owner(ctx, zone)
+	if err != nil {
+		return err
+	}
+	return accountError(a, a.client.UpdateRRSet(ctx, zone, name, recordType, record))
+}
+
+func accountError(a *account, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("account %s: %w", a.name, err)
+}
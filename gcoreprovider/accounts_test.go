@@ -0,0 +1,148 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_accountRouter(t *testing.T) {
+	ctx := context.Background()
+	prod := newMemoryDNS("example.com", "shared.com")
+	staging := newMemoryDNS("staging.com", "shared.com")
+	other := newMemoryDNS("other.com")
+	for _, m := range []*memoryDNS{prod, staging, other} {
+		for _, zone := range m.zones {
+			_ = m.AddZoneRRSet(ctx, zone, "www."+zone, "A", []gdns.ResourceRecord{
+				*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+			}, 10)
+		}
+	}
+	router := newAccountRouter(
+		&account{name: "prod", client: prod},
+		&account{name: "staging", client: staging, zones: endpoint.NewDomainFilter([]string{"staging.com", "shared.com"})},
+		&account{name: "other", client: other},
+	)
+	p := &DnsProvider{client: router, locker: newZoneLocker(defaultApplyQueueLength)}
+	records, err := p.Records(ctx)
+	if err != nil || len(records) != 4 {
+		t.Fatalf("Records() = %v, %v", records, err)
+	}
+	err = p.ApplyChanges(ctx, &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("new.shared.com", "A", 10, "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("new.other.com", "A", 10, "2.2.2.2"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = staging.RRSet(ctx, "shared.com", "new.shared.com", "A"); err != nil {
+		t.Errorf("shared.com must be written to the account claiming it: %v", err)
+	}
+	if _, err = prod.RRSet(ctx, "shared.com", "new.shared.com", "A"); err == nil {
+		t.Error("shared.com written to the account listing it without claiming it")
+	}
+	if _, err = other.RRSet(ctx, "other.com", "new.other.com", "A"); err != nil {
+		t.Errorf("other.com must be written to the account listing it: %v", err)
+	}
+	if _, err = router.owner(ctx, "unknown.com"); !errors.Is(err, ErrNoAccount) {
+		t.Errorf("owner(unknown.com) error = %v", err)
+	}
+}
+
+func Test_accountRouter_ambiguous(t *testing.T) {
+	ctx := context.Background()
+	router := newAccountRouter(
+		&account{name: "a", client: newMemoryDNS("example.com", "a.com")},
+		&account{name: "b", client: newMemoryDNS("example.com")},
+	)
+	if zones, err := router.AllZonesWithRecords(ctx, nil); err != nil || len(zones) != 1 || zones[0].Name != "a.com" {
+		t.Errorf("AllZonesWithRecords() = %v, %v, want only a.com", zones, err)
+	}
+	if _, err := router.owner(ctx, "example.com"); !errors.Is(err, ErrAmbiguousZone) {
+		t.Errorf("owner() error = %v", err)
+	}
+	router = newAccountRouter(
+		&account{name: "a", client: newMemoryDNS(), zones: endpoint.NewDomainFilter([]string{"example.com"})},
+		&account{name: "b", client: newMemoryDNS(), zones: endpoint.NewDomainFilter([]string{"sub.example.com"})},
+	)
+	if _, err := router.owner(ctx, "sub.example.com"); !errors.Is(err, ErrAmbiguousZone) {
+		t.Errorf("owner() of a zone claimed twice error = %v", err)
+	}
+}
+
+func Test_accountRouter_ZonesWithParam(t *testing.T) {
+	ctx := context.Background()
+	router := newAccountRouter(
+		&account{name: "a", client: newMemoryDNS("a1.com", "a2.com", "a3.com")},
+		&account{name: "b", client: newMemoryDNS()},
+		&account{name: "c", client: newMemoryDNS("c1.com", "c2.com")},
+	)
+	want := []string{"a1.com", "a2.com", "a3.com", "c1.com", "c2.com"}
+	for _, limit := range []uint64{1, 2, 4, 10} {
+		var got []string
+		for offset := uint64(0); offset < uint64(len(want)); offset += limit {
+			page, err := router.ZonesWithParam(ctx, gdns.ZonesParam{Offset: offset, Limit: limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.TotalAmount != len(want) {
+				t.Errorf("limit %d offset %d: TotalAmount = %d, want %d", limit, offset, page.TotalAmount, len(want))
+			}
+			if uint64(len(page.Zones)) > limit {
+				t.Errorf("limit %d offset %d: %d zones", limit, offset, len(page.Zones))
+			}
+			for _, z := range page.Zones {
+				got = append(got, z.Name)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("limit %d: paged zones = %v, want %v", limit, got, want)
+		}
+	}
+	if page, err := router.ZonesWithParam(ctx, gdns.ZonesParam{}); err != nil || len(page.Zones) != len(want) {
+		t.Errorf("ZonesWithParam() without limit = %v, %v", page, err)
+	}
+}
+
+func TestNewProvider_accounts(t *testing.T) {
+	auths := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths[r.Header.Get("Authorization")] = r.URL.Path
+		_, _ = w.Write([]byte(`{"zones":[],"total_amount":0}`))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProvider(endpoint.DomainFilter{}, srv.URL, "", false, WithAccounts(
+		AccountConfig{Name: "a", Token: "a-token"},
+		AccountConfig{Name: "b", TokenFile: file, Zones: []string{"example.com"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err = p.client.ZonesWithParam(context.Background(), gdns.ZonesParam{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auths["APIKey a-token"]; !ok || len(auths) != 2 {
+		t.Errorf("accounts not queried with their tokens: %v", auths)
+	}
+	if _, ok := auths["APIKey file-token"]; !ok {
+		t.Errorf("token file of account b not used: %v", auths)
+	}
+	if _, err = NewProvider(endpoint.DomainFilter{}, srv.URL, "token", false,
+		WithAccounts(AccountConfig{Name: DefaultAccount, Token: "x"})); err == nil {
+		t.Error("NewProvider() must reject an account named like the default one")
+	}
+}
@@ -0,0 +1,326 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	// AuditStdout as audit log path writes entries to stdout
+	AuditStdout = "-"
+
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeAborted = "aborted"
+	AuditOutcomePlanned = "planned" // dry-run
+
+	defaultAuditMaxSize    = 10 << 20
+	defaultAuditMaxBackups = 5
+	redacted               = "***"
+)
+
+// AuditEntry is one line of the append-only audit log
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Action     string    `json:"action"`
+	Zone       string    `json:"zone"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	OldTargets []string  `json:"oldTargets,omitempty"`
+	NewTargets []string  `json:"newTargets,omitempty"`
+	TTL        int64     `json:"ttl"`
+	DryRun     bool      `json:"dryRun"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditConfig describes where the audit log is written
+type AuditConfig struct {
+	// Path of the JSON-lines file, AuditStdout for stdout, empty disables the audit log
+	Path string
+	// MaxSize in bytes after which the file is rotated to Path.1, Path.2 ...
+	MaxSize int64
+	// MaxBackups is the number of rotated files to keep
+	MaxBackups int
+}
+
+// auditLog appends JSON lines to a size rotated file
+type auditLog struct {
+	cfg  AuditConfig
+	mu   sync.Mutex
+	out  io.Writer
+	file *os.File
+	size int64
+	// secrets are replaced in error messages, so credentials never end up in the audit log
+	secrets []string
+}
+
+func newAuditLog(cfg AuditConfig, secrets ...string) (*auditLog, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultAuditMaxSize
+	}
+	if cfg.MaxBackups <= 0 {
+		cfg.MaxBackups = defaultAuditMaxBackups
+	}
+	a := &auditLog{cfg: cfg}
+	for _, s := range secrets {
+		if s != "" {
+			a.secrets = append(a.secrets, s)
+		}
+	}
+	if cfg.Path == AuditStdout {
+		a.out = os.Stdout
+		return a, nil
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// addSecret hides a new credential, e.g. a reloaded token, known ones are skipped
+func (a *auditLog) addSecret(secret string) {
+	if a == nil || secret == "" {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !contains(a.secrets, secret) {
+		a.secrets = append(a.secrets, secret)
+	}
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat audit log: %w", err)
+	}
+	a.file, a.out, a.size = f, f, st.Size()
+	return nil
+}
+
+// rotate shifts Path.N-1 to Path.N and the current file to Path.1, must be called with mu held.
+// When the rename fails writing goes on in Path, when reopening fails the next write retries it.
+func (a *auditLog) rotate() error {
+	err := a.file.Close()
+	a.file, a.out = nil, nil
+	if err == nil {
+		for i := a.cfg.MaxBackups - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", a.cfg.Path, i), fmt.Sprintf("%s.%d", a.cfg.Path, i+1))
+		}
+		err = os.Rename(a.cfg.Path, a.cfg.Path+".1")
+	}
+	if openErr := a.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+func (a *auditLog) write(entries ...AuditEntry) {
+	if a == nil || len(entries) == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range entries {
+		for _, s := range a.secrets {
+			e.Error = strings.ReplaceAll(e.Error, s, redacted)
+		}
+		bs, err := json.Marshal(e)
+		if err != nil {
+			log.Errorf("%s: audit log: %v", ProviderName, err)
+			continue
+		}
+		bs = append(bs, '\n')
+		if a.file != nil && a.size > 0 && a.size+int64(len(bs)) > a.cfg.MaxSize {
+			if err = a.rotate(); err != nil {
+				log.Errorf("%s: audit log rotate: %v", ProviderName, err)
+			}
+		}
+		if a.out == nil {
+			if err = a.open(); err != nil {
+				log.Errorf("%s: audit log: %v", ProviderName, err)
+				return
+			}
+		}
+		n, err := a.out.Write(bs)
+		a.size += int64(n)
+		if err != nil {
+			log.Errorf("%s: audit log write: %v", ProviderName, err)
+		}
+	}
+}
+
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// auditOp writes the outcome of a single RRSet operation done outside ApplyChanges,
+// e.g. a purge by the janitor, a restore or an undo
+func (p *DnsProvider) auditOp(ctx context.Context, action, zone, name, recordType string,
+	oldTargets, newTargets []string, ttl int64, dryRun bool, err error) {
+	if p.audit == nil {
+		return
+	}
+	e := AuditEntry{
+		Time:       time.Now().UTC(),
+		RequestID:  RequestID(ctx),
+		Action:     action,
+		Zone:       zone,
+		Name:       name,
+		Type:       recordType,
+		OldTargets: oldTargets,
+		NewTargets: newTargets,
+		TTL:        ttl,
+		DryRun:     dryRun,
+		Outcome:    AuditOutcomeSuccess,
+	}
+	switch {
+	case err != nil:
+		e.Outcome, e.Error = AuditOutcomeFailure, err.Error()
+	case dryRun:
+		e.Outcome = AuditOutcomePlanned
+	}
+	p.audit.write(e)
+}
+
+// auditBatch collects outcomes of a single ApplyChanges, one entry per changed endpoint
+type auditBatch struct {
+	log     *auditLog
+	mu      sync.Mutex
+	entries []AuditEntry
+	index   map[string]int
+}
+
+func auditKey(action, name, recordType string) string {
+	return action + " " + name + " " + recordType
+}
+
+func (p *DnsProvider) newAuditBatch(ctx context.Context, changes *plan.Changes,
+	extractZone func(name string) (zone string)) *auditBatch {
+	if p.audit == nil {
+		return nil
+	}
+	b := &auditBatch{log: p.audit, index: map[string]int{}}
+	outcome := AuditOutcomeSuccess
+	if p.dryRun {
+		outcome = AuditOutcomePlanned
+	}
+	add := func(action string, e *endpoint.Endpoint, oldTargets, newTargets []string) {
+		zone := extractZone(e.DNSName)
+		if zone == "" {
+			return
+		}
+		b.index[auditKey(action, e.DNSName, e.RecordType)] = len(b.entries)
+		b.entries = append(b.entries, AuditEntry{
+			RequestID:  RequestID(ctx),
+			Action:     action,
+			Zone:       zone,
+			Name:       e.DNSName,
+			Type:       e.RecordType,
+			OldTargets: oldTargets,
+			NewTargets: newTargets,
+			TTL:        int64(e.RecordTTL),
+			DryRun:     p.dryRun,
+			Outcome:    outcome,
+		})
+	}
+	for _, c := range changes.Create {
+		if c.RecordType != "TXT" {
+			add("create", c, nil, c.Targets)
+		}
+	}
+	for _, u := range changes.UpdateNew {
+		var oldTargets []string
+		for _, o := range changes.UpdateOld {
+			if o.DNSName == u.DNSName && o.RecordType == u.RecordType {
+				oldTargets = o.Targets
+				break
+			}
+		}
+		add("update", u, oldTargets, u.Targets)
+	}
+	for _, d := range changes.Delete {
+		add("delete", d, d.Targets, nil)
+	}
+	return b
+}
+
+// fail marks the entry as failed, nil err keeps it successful
+func (b *auditBatch) fail(action, name, recordType string, err error) {
+	if b == nil || err == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i, ok := b.index[auditKey(action, name, recordType)]; ok {
+		b.entries[i].Outcome = AuditOutcomeFailure
+		b.entries[i].Error = err.Error()
+	}
+}
+
+// failAll marks entries of the action which did not fail on their own, e.g. updates never sent
+func (b *auditBatch) failAll(action string, err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.entries {
+		if b.entries[i].Action == action && b.entries[i].Outcome == AuditOutcomeSuccess {
+			b.entries[i].Outcome = AuditOutcomeFailure
+			b.entries[i].Error = "not applied: " + err.Error()
+		}
+	}
+}
+
+// abort marks all entries as not applied at all
+func (b *auditBatch) abort(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := range b.entries {
+		b.entries[i].Outcome = AuditOutcomeAborted
+		b.entries[i].Error = err.Error()
+	}
+}
+
+func (b *auditBatch) flush() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now().UTC()
+	for i := range b.entries {
+		b.entries[i].Time = now
+	}
+	b.log.write(b.entries...)
+}
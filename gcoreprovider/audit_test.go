@@ -0,0 +1,144 @@
+package gcoreprovider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func readAudit(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+	res := make([]AuditEntry, 0)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e AuditEntry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("decode audit line %q: %v", sc.Text(), err)
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+func Test_dnsProvider_ApplyChanges_audit(t *testing.T) {
+	const token = "secret-token"
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditLog(AuditConfig{Path: path}, token)
+	if err != nil {
+		t.Fatalf("newAuditLog() error = %v", err)
+	}
+	p := &DnsProvider{
+		client: dnsManagerMock{
+			zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+				return []gdns.Zone{{Name: "test.com"}}, nil
+			},
+			addZoneRRSet: func(ctx context.Context, zone, recordName, recordType string, values []gdns.ResourceRecord, ttl int) error {
+				return nil
+			},
+			deleteRRSetRecord: func(ctx context.Context, zone, name, recordType string, contents ...string) error {
+				return fmt.Errorf("request with %s failed", token)
+			},
+		},
+		audit: audit,
+	}
+	ctx := WithRequestID(context.Background(), "req-1")
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 10, "1.1.1.1")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.test.com", "A", 10, "1.1.1.2")},
+	})
+	if err == nil {
+		t.Fatalf("ApplyChanges() expected error")
+	}
+	entries := readAudit(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("audit entries = %+v", entries)
+	}
+	create, del := entries[0], entries[1]
+	if create.Action != "create" || create.Zone != "test.com" || create.Name != "new.test.com" ||
+		create.RequestID != "req-1" || create.TTL != 10 || create.Outcome != AuditOutcomeSuccess ||
+		len(create.NewTargets) != 1 || create.NewTargets[0] != "1.1.1.1" {
+		t.Errorf("create entry = %+v", create)
+	}
+	if del.Action != "delete" || del.Outcome != AuditOutcomeFailure || len(del.OldTargets) != 1 {
+		t.Errorf("delete entry = %+v", del)
+	}
+	if bs, _ := os.ReadFile(path); strings.Contains(string(bs), token) {
+		t.Errorf("audit log contains the API token: %s", bs)
+	}
+}
+
+func Test_auditLog_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditLog(AuditConfig{Path: path, MaxSize: 200, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("newAuditLog() error = %v", err)
+	}
+	defer audit.Close()
+	for i := 0; i < 10; i++ {
+		audit.write(AuditEntry{Action: "create", Name: fmt.Sprintf("r%d.test.com", i)})
+	}
+	for _, f := range []string{path, path + ".1", path + ".2"} {
+		st, err := os.Stat(f)
+		if err != nil {
+			t.Fatalf("stat %s: %v", f, err)
+		}
+		if st.Size() > 200 {
+			t.Errorf("%s size = %d, want <= 200", f, st.Size())
+		}
+	}
+	if _, err = os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("only 2 backups must be kept, stat = %v", err)
+	}
+	entries := readAudit(t, path)
+	if last := entries[len(entries)-1]; last.Name != "r9.test.com" {
+		t.Errorf("last entry = %+v", last)
+	}
+}
+
+func Test_auditLog_rotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// a directory in place of the first backup makes every rotation fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	audit, err := newAuditLog(AuditConfig{Path: path, MaxSize: 200, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("newAuditLog() error = %v", err)
+	}
+	defer audit.Close()
+	for i := 0; i < 5; i++ {
+		audit.write(AuditEntry{Action: "create", Name: fmt.Sprintf("r%d.test.com", i)})
+	}
+	if entries := readAudit(t, path); len(entries) != 5 || entries[4].Name != "r4.test.com" {
+		t.Errorf("entries after failed rotations = %+v", entries)
+	}
+}
+
+func Test_auditLog_addSecret(t *testing.T) {
+	audit, err := newAuditLog(AuditConfig{Path: filepath.Join(t.TempDir(), "audit.log")}, "token")
+	if err != nil {
+		t.Fatalf("newAuditLog() error = %v", err)
+	}
+	defer audit.Close()
+	for i := 0; i < 3; i++ {
+		audit.addSecret("token")
+		audit.addSecret("rotated")
+	}
+	if len(audit.secrets) != 2 {
+		t.Errorf("secrets = %v, want each once", audit.secrets)
+	}
+}
@@ -0,0 +1,31 @@
+package gcoreprovider
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ctxKey int
+
+const requestIDKey ctxKey = iota
+
+// WithRequestID attaches the ID of the incoming webhook request to ctx,
+// so provider logs and the audit log can be correlated with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID set by WithRequestID or an empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// logger returns the standard logger with the request ID of ctx, if any
+func logger(ctx context.Context) *log.Entry {
+	if id := RequestID(ctx); id != "" {
+		return log.WithField("requestId", id)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
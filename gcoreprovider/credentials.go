@@ -0,0 +1,389 @@
+package gcoreprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	AuthModeAPIKey = "apikey" // permanent API token, "Authorization: APIKey <token>"
+	AuthModeBearer = "bearer" // short-lived JWT, "Authorization: Bearer <token>"
+
+	// permanentTokenScheme is the Authorization scheme of Gcore permanent API tokens
+	permanentTokenScheme        = "APIKey"
+	bearerTokenScheme           = "Bearer"
+	defaultTokenFileInterval    = 10 * time.Second
+	defaultTokenRefreshBefore   = time.Minute
+	tokenCommandTimeout         = 30 * time.Second
+	tokenSourceFile             = "file"
+	tokenSourceCommand          = "command"
+	maxTokenCommandErrorMessage = 200
+)
+
+// ErrTokenUnchanged is returned when a refresh after a 401 gets the rejected token again
+var ErrTokenUnchanged = errors.New("token source returned the rejected token")
+
+// TokenFileConfig makes the provider read the API token from a file, e.g. a mounted Secret
+type TokenFileConfig struct {
+	Path string
+	// Interval between checks of the file or the expiry of a token from AuthConfig.Command, 10s when zero
+	Interval time.Duration
+}
+
+func (c TokenFileConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultTokenFileInterval
+	}
+	return c.Interval
+}
+
+// AuthConfig selects how Gcore API requests are authenticated
+type AuthConfig struct {
+	// Mode is AuthModeAPIKey, the default, or AuthModeBearer
+	Mode string
+	// Command prints a fresh token on stdout, it runs at startup, before the token expires and after a 401
+	Command string
+	// RefreshBefore is how long before the expiry of a JWT a new one is fetched, 1m when zero
+	RefreshBefore time.Duration
+}
+
+func (c AuthConfig) scheme() string {
+	if c.Mode == AuthModeBearer {
+		return bearerTokenScheme
+	}
+	return permanentTokenScheme
+}
+
+func (c AuthConfig) refreshBefore() time.Duration {
+	if c.RefreshBefore <= 0 {
+		return defaultTokenRefreshBefore
+	}
+	return c.RefreshBefore
+}
+
+// TokenCheck is the state of the token file or command, a failed check keeps the previous token
+type TokenCheck struct {
+	Source     string     `json:"source"`
+	File       string     `json:"file,omitempty"`
+	OK         bool       `json:"ok"`
+	CheckedAt  time.Time  `json:"checkedAt"`
+	LastReload *time.Time `json:"lastReload,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// credentials hold the API token, requests read it when they are sent,
+// so the token can be replaced while the provider serves requests.
+type credentials struct {
+	mu     sync.RWMutex
+	scheme string
+	token  string
+	// expiresAt is the exp claim of a JWT, zero for other tokens
+	expiresAt time.Time
+	// state of the token source
+	checkedAt  time.Time
+	lastReload time.Time
+	sourceErr  error
+	// refreshMu lets a single refresh run, requests rejected meanwhile reuse its token
+	refreshMu sync.Mutex
+}
+
+func newCredentials(token string) *credentials {
+	return &credentials{scheme: permanentTokenScheme, token: token, expiresAt: jwtExpiry(token)}
+}
+
+func (c *credentials) get() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+func (c *credentials) authorization(token string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.scheme + " " + token
+}
+
+func (c *credentials) setScheme(scheme string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scheme = scheme
+}
+
+// set replaces the token and tells if it changed
+func (c *credentials) set(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := c.token != token
+	c.token = token
+	c.expiresAt = jwtExpiry(token)
+	return changed
+}
+
+// expiresWithin tells if the token is a JWT expiring before now+d
+func (c *credentials) expiresWithin(now time.Time, d time.Duration) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.expiresAt.IsZero() && now.Add(d).After(c.expiresAt)
+}
+
+func (c *credentials) loaded(at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt, c.lastReload, c.sourceErr = at, at, nil
+}
+
+func (c *credentials) checked(at time.Time, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt, c.sourceErr = at, err
+}
+
+func (c *credentials) check(source, file string) *TokenCheck {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := &TokenCheck{Source: source, File: file, OK: c.sourceErr == nil, CheckedAt: c.checkedAt}
+	if !c.lastReload.IsZero() {
+		last := c.lastReload
+		res.LastReload = &last
+	}
+	if !c.expiresAt.IsZero() {
+		exp := c.expiresAt
+		res.ExpiresAt = &exp
+	}
+	if c.sourceErr != nil {
+		res.Error = c.sourceErr.Error()
+	}
+	return res
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it, the Gcore API does that;
+// it only tells when to fetch the next token. Zero when token is not a JWT or has no exp.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	claims := struct {
+		Exp float64 `json:"exp"`
+	}{}
+	if err = json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.Exp), 0)
+}
+
+func readTokenFile(path string) (string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(bs))
+	if token == "" {
+		return "", errors.New("read token file: " + path + " is empty")
+	}
+	return token, nil
+}
+
+// runTokenCommand runs command with sh and returns its trimmed stdout
+func runTokenCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+	defer cancel()
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxTokenCommandErrorMessage {
+			msg = msg[:maxTokenCommandErrorMessage]
+		}
+		return "", fmt.Errorf("run token command: %w: %s", err, msg)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", errors.New("run token command: empty output")
+	}
+	return token, nil
+}
+
+func (p *DnsProvider) hasTokenSource() bool {
+	return p.tokenFile.Path != "" || p.auth.Command != ""
+}
+
+func (p *DnsProvider) tokenSource() string {
+	if p.tokenFile.Path != "" {
+		return tokenSourceFile
+	}
+	return tokenSourceCommand
+}
+
+// fetchToken reads the token from the file, or else runs the command
+func (p *DnsProvider) fetchToken(ctx context.Context) (string, error) {
+	if p.tokenFile.Path != "" {
+		return readTokenFile(p.tokenFile.Path)
+	}
+	return runTokenCommand(ctx, p.auth.Command)
+}
+
+// tokenCheck is the readiness view of the token source, nil for a static token
+func (p *DnsProvider) tokenCheck() *TokenCheck {
+	if !p.hasTokenSource() {
+		return nil
+	}
+	return p.credentials.check(p.tokenSource(), p.tokenFile.Path)
+}
+
+// watchToken polls the token file, polling also follows the symlink swaps of Kubernetes Secret
+// volumes, and fetches a new token when the current JWT is about to expire.
+func (p *DnsProvider) watchToken(ctx context.Context) {
+	p.metrics.tokenChecked(nil, false)
+	ticker := time.NewTicker(p.tokenFile.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expiring := p.credentials.expiresWithin(now, p.auth.refreshBefore())
+			if p.tokenFile.Path != "" || expiring {
+				_, _ = p.reloadToken(ctx)
+			}
+			if expiring && p.credentials.expiresWithin(now, p.auth.refreshBefore()) {
+				log.Warnf("%s: API token expires at %s and no newer one is available",
+					ProviderName, p.tokenCheck().ExpiresAt.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// reloadToken switches new requests to the token of the source, on error the previous token is kept
+func (p *DnsProvider) reloadToken(ctx context.Context) (changed bool, err error) {
+	now := time.Now()
+	token, err := p.fetchToken(ctx)
+	if err != nil {
+		if p.tokenCheck().OK {
+			log.Errorf("%s: keeping the previous API token: %v", ProviderName, err)
+		}
+		p.credentials.checked(now, err)
+		p.metrics.tokenChecked(err, false)
+		return false, err
+	}
+	// a new token is known to the redactor before any request can carry it
+	if token != p.credentials.get() {
+		p.addSecret(token)
+	}
+	changed = p.credentials.set(token)
+	if changed {
+		p.credentials.loaded(now)
+		log.Infof("%s: API token reloaded from the token %s", ProviderName, p.tokenSource())
+	} else {
+		p.credentials.checked(now, nil)
+	}
+	p.metrics.tokenChecked(nil, changed)
+	return changed, nil
+}
+
+// refreshRejected fetches a new token after the API rejected rejected, concurrent
+// requests rejected with the same token wait for a single refresh and reuse its result.
+func (p *DnsProvider) refreshRejected(ctx context.Context, rejected string) error {
+	p.credentials.refreshMu.Lock()
+	defer p.credentials.refreshMu.Unlock()
+	if p.credentials.get() != rejected {
+		return nil
+	}
+	changed, err := p.reloadToken(ctx)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return ErrTokenUnchanged
+	}
+	return nil
+}
+
+// addSecret hides a new token in the audit log and the logs
+func (p *DnsProvider) addSecret(token string) {
+	p.audit.addSecret(token)
+	if p.redactor != nil {
+		p.redactor.Add(token)
+	}
+}
+
+// authTransport overrides the Authorization header the SDK set when the client was created.
+// With refresh set, a request answered 401 is sent once more with a refreshed token.
+type authTransport struct {
+	base        http.RoundTripper
+	credentials *credentials
+	refresh     func(ctx context.Context, rejected string) error
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := t.credentials.get()
+	resp, err := t.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.refresh == nil ||
+		req.Body != nil && req.GetBody == nil {
+		return resp, err
+	}
+	if refreshErr := t.refresh(req.Context(), token); refreshErr != nil {
+		log.Warnf("%s: token refresh after 401 failed: %v", ProviderName, refreshErr)
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.send(retry, t.credentials.get())
+}
+
+func (t *authTransport) send(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", t.credentials.authorization(token))
+	return t.base.RoundTrip(req)
+}
+
+// authenticate makes c send the current token of creds, refresh is called after a 401 when set
+func authenticate(c *gdns.Client, creds *credentials, refresh func(ctx context.Context, rejected string) error) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
+	}
+	base := c.HTTPClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.HTTPClient.Transport = &authTransport{base: base, credentials: creds, refresh: refresh}
+}
+
+// setupClient applies the HTTP client settings, authentication and tracing to a Gcore API client
+func (p *DnsProvider) setupClient(c *gdns.Client, creds *credentials,
+	refresh func(ctx context.Context, rejected string) error) error {
+	c.Debug = p.apiDebug
+	if err := configureHTTPClient(c, p.httpClient); err != nil {
+		return err
+	}
+	authenticate(c, creds, refresh)
+	traceTransport(c)
+	return nil
+}
@@ -0,0 +1,178 @@
+package gcoreprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func Test_dnsProvider_tokenFile(t *testing.T) {
+	auth := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("first-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactor := NewRedactor()
+	p, err := NewProvider(endpoint.DomainFilter{}, srv.URL, "", false,
+		WithTokenFile(TokenFileConfig{Path: file}), WithMetrics(metrics), WithRedactor(redactor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if got := logRedacted(redactor, "using first-token"); got != "using ***" {
+		t.Errorf("first token from the file is logged as %q", got)
+	}
+	ctx := context.Background()
+	call := func() string {
+		t.Helper()
+		if _, err := p.client.ZonesWithParam(ctx, gdns.ZonesParam{Limit: 1}); err != nil {
+			t.Fatal(err)
+		}
+		return auth
+	}
+	if got := call(); got != "APIKey first-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	for i := 0; i < 3; i++ {
+		p.reloadToken(ctx)
+	}
+	if n := len(redactor.secrets); n != 1 {
+		t.Errorf("redacted secrets after reloading an unchanged token = %d, want 1", n)
+	}
+
+	if err = os.WriteFile(file, []byte("second-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p.reloadToken(ctx)
+	if got := call(); got != "APIKey second-token" {
+		t.Errorf("Authorization after rotation = %q", got)
+	}
+	if got := redactor.Redact("second-token"); got != redacted {
+		t.Errorf("rotated token is not redacted: %q", got)
+	}
+	if n := testutil.ToFloat64(metrics.tokenReloads.WithLabelValues("success")); n != 1 {
+		t.Errorf("successful reloads = %v", n)
+	}
+
+	if err = os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	p.reloadToken(ctx)
+	if got := call(); got != "APIKey second-token" {
+		t.Errorf("failed reload must keep the token, Authorization = %q", got)
+	}
+	report := p.Readiness(ctx)
+	if !report.Ready || !report.Degraded || report.Token == nil || report.Token.OK || report.Token.Error == "" {
+		t.Errorf("Readiness() = %+v, token %+v", report, report.Token)
+	}
+	if n := testutil.ToFloat64(metrics.tokenFileOK); n != 0 {
+		t.Errorf("token_file_ok = %v", n)
+	}
+}
+
+// logRedacted returns the message of a log line written through a redacting formatter
+func logRedacted(r *Redactor, msg string) string {
+	out := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(out)
+	logger.SetFormatter(NewRedactingFormatter(&log.TextFormatter{DisableTimestamp: true, DisableQuote: true}, r))
+	logger.Info(msg)
+	return strings.TrimSpace(strings.TrimPrefix(out.String(), "level=info msg="))
+}
+
+func TestNewProvider_tokenFileMissing(t *testing.T) {
+	_, err := NewProvider(endpoint.DomainFilter{}, "", "", false,
+		WithTokenFile(TokenFileConfig{Path: filepath.Join(t.TempDir(), "missing")}))
+	if err == nil {
+		t.Error("NewProvider() must fail without a readable token file")
+	}
+}
+
+func Test_dnsProvider_bearerRefreshOn401(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"token expired"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "issued")
+	if err := os.WriteFile(file, []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProvider(endpoint.DomainFilter{}, srv.URL, "", false,
+		WithAuth(AuthConfig{Mode: AuthModeBearer, Command: "cat " + file}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err = os.WriteFile(file, []byte("fresh"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.client.ZonesWithParam(context.Background(), gdns.ZonesParam{Limit: 1}); err != nil {
+		t.Fatalf("ZonesWithParam() error = %v", err)
+	}
+	if requests != 2 || p.credentials.get() != "fresh" {
+		t.Errorf("requests = %d, token = %q, want a single retry with the fresh token", requests, p.credentials.get())
+	}
+}
+
+func TestNewProvider_tokenCommandRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer srv.Close()
+	redactor := NewRedactor()
+	p, err := NewProvider(endpoint.DomainFilter{}, srv.URL, "", false,
+		WithAuth(AuthConfig{Command: "echo command-token"}), WithRedactor(redactor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if got := logRedacted(redactor, "using command-token"); got != "using ***" {
+		t.Errorf("first token of the command is logged as %q", got)
+	}
+}
+
+func Test_jwtExpiry(t *testing.T) {
+	enc := base64.RawURLEncoding.EncodeToString
+	token := enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte(`{"exp":1700000000}`)) + ".sig"
+	if got := jwtExpiry(token); !got.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("jwtExpiry() = %v", got)
+	}
+	for _, token := range []string{"permanent-api-key", "a.b.c", enc([]byte(`{}`)) + "." + enc([]byte(`{"sub":"x"}`)) + ".sig"} {
+		if got := jwtExpiry(token); !got.IsZero() {
+			t.Errorf("jwtExpiry(%q) = %v, want zero", token, got)
+		}
+	}
+	c := newCredentials(token)
+	if !c.expiresWithin(time.Unix(1700000000-30, 0), time.Minute) || c.expiresWithin(time.Unix(1700000000-120, 0), time.Minute) {
+		t.Error("expiresWithin() must compare the exp claim with the refresh margin")
+	}
+}
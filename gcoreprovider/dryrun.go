@@ -0,0 +1,186 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OperationCreateRRSet = "CreateRRSet"
+	OperationUpdateRRSet = "UpdateRRSet"
+	OperationDeleteRRSet = "DeleteRRSet"
+)
+
+// DryRunPlan is the machine-readable result of ApplyChanges in dry-run mode
+type DryRunPlan struct {
+	RequestID  string           `json:"requestId,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	Operations []RRSetOperation `json:"operations"`
+	// Errors of reading the current state, operations on such RRSets assume they do not exist
+	Errors []string `json:"errors,omitempty"`
+	// Warnings about side effects of the operations, e.g. RRSet meta or filters the apply drops
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RRSetOperation is a single Gcore API write the apply would run
+type RRSetOperation struct {
+	// Change is the external-dns change kind: create, update or delete
+	Change string `json:"change"`
+	// Operation is CreateRRSet, UpdateRRSet or DeleteRRSet
+	Operation string      `json:"operation"`
+	Zone      string      `json:"zone"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Before    *gdns.RRSet `json:"before"`
+	After     *gdns.RRSet `json:"after"`
+}
+
+// dryRunPlanner simulates ApplyChanges on RRSets read from the API without writing anything
+type dryRunPlanner struct {
+	p     *DnsProvider
+	plan  *DryRunPlan
+	state map[string]*gdns.RRSet
+}
+
+func (p *DnsProvider) newDryRunPlanner(ctx context.Context) *dryRunPlanner {
+	return &dryRunPlanner{
+		p:     p,
+		plan:  &DryRunPlan{RequestID: RequestID(ctx), CreatedAt: time.Now().UTC(), Operations: []RRSetOperation{}},
+		state: map[string]*gdns.RRSet{},
+	}
+}
+
+// current returns the simulated RRSet, nil when it does not exist
+func (d *dryRunPlanner) current(ctx context.Context, zone, name, recordType string) *gdns.RRSet {
+	key := strings.Join([]string{zone, name, recordType}, " ")
+	if rrSet, ok := d.state[key]; ok {
+		return rrSet
+	}
+	res, err := d.p.readRRSet(ctx, zone, name, recordType)
+	if err != nil {
+		d.plan.Errors = append(d.plan.Errors, fmt.Sprintf("%s %s: %v", name, recordType, err))
+	}
+	d.state[key] = res
+	return res
+}
+
+func (d *dryRunPlanner) set(zone, name, recordType string, rrSet *gdns.RRSet) {
+	d.state[strings.Join([]string{zone, name, recordType}, " ")] = rrSet
+}
+
+// deleteRecords mirrors DeleteRRSetRecord or the soft delete
+func (d *dryRunPlanner) deleteRecords(ctx context.Context, change, zone, name, recordType string, contents []string) {
+	before := d.current(ctx, zone, name, recordType)
+	if before == nil {
+		return
+	}
+	after := copyRRSet(before)
+	after.Records = after.Records[:0]
+	for _, r := range before.Records {
+		if !contains(contents, r.ContentToString()) {
+			after.Records = append(after.Records, r)
+			continue
+		}
+		if d.p.softDelete != nil {
+			r.Enabled = false
+			after.Records = append(after.Records, r)
+		}
+	}
+	op := OperationUpdateRRSet
+	if len(after.Records) == 0 {
+		op, after = OperationDeleteRRSet, nil
+	}
+	d.add(change, op, zone, name, recordType, before, after)
+}
+
+// addRecords mirrors AddZoneRRSet, soft-deleted values are re-enabled. The SDK PUTs only
+// the TTL and records, so meta and filters of an existing RRSet are lost.
+func (d *dryRunPlanner) addRecords(ctx context.Context, change, zone, name, recordType string,
+	values []gdns.ResourceRecord, ttl int) {
+	before := d.current(ctx, zone, name, recordType)
+	after := &gdns.RRSet{Type: recordType, TTL: ttl}
+	op := OperationCreateRRSet
+	if before != nil {
+		op = OperationUpdateRRSet
+		after.Records = append([]gdns.ResourceRecord{}, before.Records...)
+		if len(before.Meta) > 0 || len(before.Filters) > 0 {
+			d.plan.Warnings = append(d.plan.Warnings,
+				fmt.Sprintf("%s %s: meta and filters of the RRSet are dropped by the update", name, recordType))
+		}
+	}
+	newRecords := make([]gdns.ResourceRecord, 0, len(values))
+	for _, v := range values {
+		restored := false
+		for i, r := range after.Records {
+			if !r.Enabled && r.ContentToString() == v.ContentToString() &&
+				d.p.softDelete != nil && d.p.softDelete.isDeleted(zone, name, recordType, v.ContentToString()) {
+				after.Records[i].Enabled, restored = true, true
+			}
+		}
+		if !restored {
+			newRecords = append(newRecords, v)
+		}
+	}
+	after.Records = append(newRecords, after.Records...)
+	d.add(change, op, zone, name, recordType, before, after)
+}
+
+func (d *dryRunPlanner) add(change, op, zone, name, recordType string, before, after *gdns.RRSet) {
+	d.set(zone, name, recordType, after)
+	d.plan.Operations = append(d.plan.Operations, RRSetOperation{
+		Change:    change,
+		Operation: op,
+		Zone:      zone,
+		Name:      name,
+		Type:      recordType,
+		Before:    before,
+		After:     after,
+	})
+}
+
+// dryRunPlans keeps the latest plan and writes it to a file when configured
+type dryRunPlans struct {
+	mu   sync.Mutex
+	last *DryRunPlan
+	file string
+}
+
+func (s *dryRunPlans) store(plan *DryRunPlan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = plan
+	if s.file == "" {
+		return
+	}
+	bs, err := json.MarshalIndent(plan, "", "  ")
+	if err == nil {
+		tmp := s.file + ".tmp"
+		if err = os.WriteFile(tmp, bs, 0o600); err == nil {
+			err = os.Rename(tmp, s.file)
+		}
+	}
+	if err != nil {
+		log.Errorf("%s: write dry-run plan %s: %v", ProviderName, s.file, err)
+	}
+}
+
+// LastDryRunPlan returns the plan of the latest ApplyChanges in dry-run mode, nil if none yet
+func (p *DnsProvider) LastDryRunPlan() *DryRunPlan {
+	p.dryRunPlans.mu.Lock()
+	defer p.dryRunPlans.mu.Unlock()
+	return p.dryRunPlans.last
+}
+
+func copyRRSet(rrSet *gdns.RRSet) *gdns.RRSet {
+	res := *rrSet
+	res.Records = append([]gdns.ResourceRecord{}, rrSet.Records...)
+	return &res
+}
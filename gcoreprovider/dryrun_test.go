@@ -0,0 +1,139 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+type writeCountingDNS struct {
+	*memoryDNS
+	writes int
+}
+
+func (w *writeCountingDNS) AddZoneRRSet(ctx context.Context, zone, recordName, recordType string,
+	values []gdns.ResourceRecord, ttl int, opts ...gdns.AddZoneOpt) error {
+	w.writes++
+	return w.memoryDNS.AddZoneRRSet(ctx, zone, recordName, recordType, values, ttl, opts...)
+}
+
+func (w *writeCountingDNS) DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error {
+	w.writes++
+	return w.memoryDNS.DeleteRRSetRecord(ctx, zone, name, recordType, contents...)
+}
+
+func (w *writeCountingDNS) CreateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	w.writes++
+	return w.memoryDNS.CreateRRSet(ctx, zone, name, recordType, record)
+}
+
+func (w *writeCountingDNS) DeleteRRSet(ctx context.Context, zone, name, recordType string) error {
+	w.writes++
+	return w.memoryDNS.DeleteRRSet(ctx, zone, name, recordType)
+}
+
+func (w *writeCountingDNS) UpdateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	w.writes++
+	return w.memoryDNS.UpdateRRSet(ctx, zone, name, recordType, record)
+}
+
+func Test_dnsProvider_ApplyChanges_dryRunPlan(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemoryDNS("test.com")
+	rr := func(v string) gdns.ResourceRecord {
+		return *(&gdns.ResourceRecord{Enabled: true}).SetContent("A", v)
+	}
+	_ = mem.AddZoneRRSet(ctx, "test.com", "upd.test.com", "A", []gdns.ResourceRecord{rr("1.1.1.1")}, 10)
+	_ = mem.AddZoneRRSet(ctx, "test.com", "del.test.com", "A", []gdns.ResourceRecord{rr("1.1.1.2")}, 10)
+	client := &writeCountingDNS{memoryDNS: mem}
+	file := filepath.Join(t.TempDir(), "plan.json")
+	p := &DnsProvider{client: client, dryRun: true}
+	WithDryRunPlanFile(file)(p)
+
+	err := p.ApplyChanges(WithRequestID(ctx, "req-1"), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 20, "1.1.1.3")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("upd.test.com", "A", 10, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("upd.test.com", "A", 10, "1.1.1.4")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("del.test.com", "A", 10, "1.1.1.2")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if client.writes != 0 {
+		t.Fatalf("dry-run must not write, writes = %d", client.writes)
+	}
+	got := p.LastDryRunPlan()
+	if got == nil || got.RequestID != "req-1" {
+		t.Fatalf("LastDryRunPlan() = %+v", got)
+	}
+	type op struct{ change, operation, name string }
+	want := []op{
+		{"update", OperationDeleteRRSet, "upd.test.com"},
+		{"delete", OperationDeleteRRSet, "del.test.com"},
+		{"create", OperationCreateRRSet, "new.test.com"},
+		{"update", OperationCreateRRSet, "upd.test.com"},
+	}
+	if len(got.Operations) != len(want) {
+		t.Fatalf("operations = %+v", got.Operations)
+	}
+	for i, w := range want {
+		o := got.Operations[i]
+		if o.Change != w.change || o.Operation != w.operation || o.Name != w.name {
+			t.Errorf("operation[%d] = %s %s %s, want %v", i, o.Change, o.Operation, o.Name, w)
+		}
+	}
+	if o := got.Operations[0]; o.Before == nil || o.Before.Records[0].ContentToString() != "1.1.1.1" || o.After != nil {
+		t.Errorf("update old before/after = %+v / %+v", o.Before, o.After)
+	}
+	if o := got.Operations[3]; o.Before != nil || o.After == nil || o.After.Records[0].ContentToString() != "1.1.1.4" {
+		t.Errorf("update new before/after = %+v / %+v", o.Before, o.After)
+	}
+
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("read plan file: %v", err)
+	}
+	var fromFile DryRunPlan
+	if err = json.Unmarshal(bs, &fromFile); err != nil || len(fromFile.Operations) != len(want) {
+		t.Errorf("plan file = %s, err = %v", bs, err)
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_dryRunPlanFilters(t *testing.T) {
+	ctx := context.Background()
+	mem := newMemoryDNS("test.com")
+	_ = mem.UpdateRRSet(ctx, "test.com", "geo.test.com", "A", gdns.RRSet{
+		Type: "A", TTL: 60,
+		Records: []gdns.ResourceRecord{{Content: []any{"2.2.2.2"}, Meta: map[string]any{"countries": []any{"DE"}}, Enabled: true}},
+		Filters: []gdns.RecordFilter{{Type: "geodistance", Limit: 1}},
+		Meta:    gdns.RRSetMeta{"failover": map[string]any{"protocol": "HTTP"}},
+	})
+	p := &DnsProvider{client: mem, dryRun: true}
+	err := p.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("geo.test.com", "A", 60, "3.3.3.3")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	got := p.LastDryRunPlan()
+	if got == nil || len(got.Operations) != 1 {
+		t.Fatalf("LastDryRunPlan() = %+v", got)
+	}
+	o := got.Operations[0]
+	if o.Operation != OperationUpdateRRSet || len(o.Before.Filters) != 1 || len(o.Before.Meta) != 1 {
+		t.Fatalf("operation = %+v, before %+v", o, o.Before)
+	}
+	if len(o.After.Filters) != 0 || len(o.After.Meta) != 0 || len(o.After.Records) != 2 ||
+		o.After.Records[1].Meta["countries"] == nil {
+		t.Errorf("after = %+v, want the records without RRSet meta and filters", o.After)
+	}
+	if len(got.Warnings) != 1 {
+		t.Errorf("warnings = %v, want the dropped meta and filters", got.Warnings)
+	}
+}
@@ -15,13 +15,17 @@ package gcoreprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	gdns "github.com/G-Core/gcore-dns-sdk-go"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/sync/errgroup"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
@@ -29,11 +33,58 @@ import (
 )
 
 const (
-	ProviderName = "gcore"
-	EnvAPIURL    = "GCORE_API_URL"
-	EnvAPIToken  = "GCORE_PERMANENT_API_TOKEN"
-	logDryRun    = "[DryRun] "
-	maxTimeout   = 60 * time.Second
+	ProviderName        = "gcore"
+	EnvAPIURL           = "GCORE_API_URL"
+	EnvAPIToken         = "GCORE_PERMANENT_API_TOKEN"
+	EnvListTimeout      = "GCORE_LIST_TIMEOUT"  // e.g. "2m", bounds listing zones and records
+	EnvApplyTimeout     = "GCORE_APPLY_TIMEOUT" // e.g. "30s", bounds a single ApplyChanges
+	EnvApplyQueueLength = "GCORE_APPLY_QUEUE_LENGTH"
+	EnvMaxDeletes       = "GCORE_MAX_DELETES"       // deleted records per apply, 0 is unlimited
+	EnvMaxDeleteShare   = "GCORE_MAX_DELETE_SHARE"  // share of zone records, e.g. 0.5, 0 is unlimited
+	EnvAllowMassDelete  = "GCORE_ALLOW_MASS_DELETE" // "true" ignores deletion limits
+	// EnvProtectedRecords is a comma separated list of <name>[/<type>], e.g. "*/MX,_acme-challenge.*"
+	EnvProtectedRecords = "GCORE_PROTECTED_RECORDS"
+	EnvProtectedRefuse  = "GCORE_PROTECTED_REFUSE"  // "true" fails the apply instead of skipping
+	EnvProtectedHide    = "GCORE_PROTECTED_HIDE"    // "true" hides protected records from external-dns
+	EnvSoftDeleteGrace  = "GCORE_SOFT_DELETE_GRACE" // e.g. "24h", deletes only disable records for this long
+	EnvSoftDeleteState  = "GCORE_SOFT_DELETE_STATE" // file to remember disabled records between restarts
+	EnvAuditLog         = "GCORE_AUDIT_LOG"         // JSON-lines file of applied changes, "-" for stdout
+	EnvAuditLogMaxSize  = "GCORE_AUDIT_LOG_MAX_SIZE_MB"
+	EnvAuditLogBackups  = "GCORE_AUDIT_LOG_MAX_BACKUPS"
+	EnvDryRunPlanFile   = "GCORE_DRY_RUN_PLAN_FILE" // JSON file with the latest dry-run plan
+	EnvSnapshotDir      = "GCORE_SNAPSHOT_DIR"      // directory of zone snapshots, empty disables them
+	// EnvSnapshotBeforeDelete "true" snapshots affected zones before every apply deleting records
+	EnvSnapshotBeforeDelete = "GCORE_SNAPSHOT_BEFORE_DELETE"
+	EnvSnapshotKeep         = "GCORE_SNAPSHOT_KEEP" // snapshot files to keep, default 20
+	EnvJournal              = "GCORE_JOURNAL"       // "true" records every apply so it can be undone
+	EnvJournalSize          = "GCORE_JOURNAL_SIZE"  // applies to keep, default 100
+	EnvJournalFile          = "GCORE_JOURNAL_FILE"  // file to keep the journal between restarts
+	// EnvReadinessCacheTTL e.g. "30s", how long the result of the readiness API check is reused
+	EnvReadinessCacheTTL = "GCORE_READINESS_CACHE_TTL"
+	// EnvReadinessMaxRecordsAge e.g. "10m", not ready without a successful Records for longer, "0" disables
+	EnvReadinessMaxRecordsAge = "GCORE_READINESS_MAX_RECORDS_AGE"
+	EnvSelfTest               = "GCORE_SELF_TEST" // "off", "warn" or "strict", see SelfTest
+	EnvAPIDebug               = "GCORE_API_DEBUG" // "true" logs every Gcore API request at debug level
+	// EnvAPITokenFile is a file holding the token, e.g. a mounted Secret, rotations are picked up
+	EnvAPITokenFile         = "GCORE_PERMANENT_API_TOKEN_FILE"
+	EnvAPITokenFileInterval = "GCORE_API_TOKEN_FILE_INTERVAL" // e.g. "30s", how often the token file is checked
+	EnvAuthMode             = "GCORE_AUTH_MODE"               // "apikey" or "bearer"
+	EnvHTTPProxy            = "GCORE_HTTP_PROXY"              // e.g. "http://proxy:3128", HTTPS_PROXY applies when empty
+	EnvCAFile               = "GCORE_CA_FILE"                 // PEM bundle trusted in addition to the system roots
+	EnvHTTPTimeout          = "GCORE_HTTP_TIMEOUT"            // e.g. "30s", bounds a single Gcore API request
+	EnvDialTimeout          = "GCORE_DIAL_TIMEOUT"
+	EnvTLSHandshakeTimeout  = "GCORE_TLS_HANDSHAKE_TIMEOUT"
+	EnvIdleConnTimeout      = "GCORE_IDLE_CONN_TIMEOUT"
+	EnvAccounts             = "GCORE_ACCOUNTS"   // YAML or JSON list of accounts, see AccountConfig
+	EnvUserAgent            = "GCORE_USER_AGENT" // default "external-dns-gcore-webhook/<version>"
+	// EnvAPITokenCommand prints a fresh token, e.g. "cat /run/token" or "my-issuer --audience gcore"
+	EnvAPITokenCommand    = "GCORE_API_TOKEN_COMMAND"
+	EnvTokenRefreshBefore = "GCORE_TOKEN_REFRESH_BEFORE" // e.g. "2m", fetch a new JWT this long before it expires
+	logDryRun             = "[DryRun] "
+	defaultListTimeout    = 60 * time.Second
+	defaultApplyTimeout   = 60 * time.Second
+	// how many ApplyChanges may wait for a busy zone before failing fast
+	defaultApplyQueueLength = 5
 )
 
 type dnsManager interface {
@@ -41,13 +92,50 @@ type dnsManager interface {
 		zone, recordName, recordType string,
 		values []gdns.ResourceRecord, ttl int, opts ...gdns.AddZoneOpt) error
 	AllZonesWithRecords(ctx context.Context, nameFilters []string) ([]gdns.Zone, error)
+	CreateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error
+	DeleteRRSet(ctx context.Context, zone, name, recordType string) error
 	DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error
+	RRSet(ctx context.Context, zone, name, recordType string) (gdns.RRSet, error)
+	ZonesWithParam(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error)
+	UpdateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error
 }
 
 type DnsProvider struct {
 	provider.BaseProvider
-	client dnsManager
-	dryRun bool
+	client      dnsManager
+	credentials *credentials
+	// settingsMu guards the settings Reload changes: domainFilter, timeouts, deletionLimits and protection
+	settingsMu sync.RWMutex
+	// domainFilter narrows managed zones and records when configured
+	domainFilter endpoint.DomainFilter
+	dryRun       bool
+	listTimeout  time.Duration
+	applyTimeout time.Duration
+	locker       *zoneLocker
+	// deletionLimits guard against wiping zones because of a broken source
+	deletionLimits DeletionLimits
+	protection     ProtectionRules
+	// softDelete is set when deletes only disable records for a grace period
+	softDelete      *softDeleter
+	softDeleteGrace time.Duration
+	softDeleteFile  string
+	stopBackground  context.CancelFunc
+	audit           *auditLog
+	auditConfig     AuditConfig
+	dryRunPlans     dryRunPlans
+	snapshots       *snapshotStore
+	journal         *journal
+	journalConfig   *JournalConfig
+	metrics         *Metrics
+	readiness       *readiness
+	readinessConfig ReadinessConfig
+	apiDebug        bool
+	httpClient      HTTPClientConfig
+	tokenFile       TokenFileConfig
+	auth            AuthConfig
+	accounts        []AccountConfig
+	// redactor learns new tokens, so they never show up in logs
+	redactor *Redactor
 }
 
 func setClientBaseURL(client interface{}, apiUrl string) (*gdns.Client, error) {
@@ -65,16 +153,70 @@ func setClientBaseURL(client interface{}, apiUrl string) (*gdns.Client, error) {
 	return c, nil
 }
 
-func NewProvider(domainFilter endpoint.DomainFilter, apiUrl, apiKey string, dryRun bool) (*DnsProvider, error) {
+func NewProvider(domainFilter endpoint.DomainFilter, apiUrl, apiKey string, dryRun bool,
+	opts ...Option) (*DnsProvider, error) {
 	log.Infof("%s: starting init provider: filters=%+v , dryRun=%v",
 		ProviderName, domainFilter.Filters, dryRun)
 	defer log.Infof("%s: finishing init provider", ProviderName)
-	if apiKey == "" {
-		return nil, EnvError("empty " + EnvAPIToken)
-	}
 	p := &DnsProvider{
-		client: gdns.NewClient(gdns.PermanentAPIKeyAuth(apiKey)),
-		dryRun: dryRun,
+		client:       gdns.NewClient(gdns.PermanentAPIKeyAuth(apiKey)),
+		credentials:  newCredentials(apiKey),
+		domainFilter: domainFilter,
+		dryRun:       dryRun,
+		listTimeout:  defaultListTimeout,
+		applyTimeout: defaultApplyTimeout,
+		locker:       newZoneLocker(defaultApplyQueueLength),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	switch p.auth.Mode {
+	case "", AuthModeAPIKey, AuthModeBearer:
+		p.credentials.setScheme(p.auth.scheme())
+	default:
+		return nil, EnvError(fmt.Sprintf("%s: unknown mode %q", EnvAuthMode, p.auth.Mode))
+	}
+	if p.hasTokenSource() {
+		token, err := p.fetchToken(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ProviderName, err)
+		}
+		apiKey = token
+		p.addSecret(token)
+		p.credentials.set(token)
+		p.credentials.loaded(time.Now())
+		log.Infof("%s: API token read from the token %s, checked every %s",
+			ProviderName, p.tokenSource(), p.tokenFile.interval())
+	}
+	if apiKey == "" && len(p.accounts) == 0 {
+		return nil, EnvError("empty " + EnvAPIToken + ", " + EnvAPITokenFile + " and " + EnvAPITokenCommand)
+	}
+	log.Infof("%s: auth scheme: %s", ProviderName, p.auth.scheme())
+	p.readiness = newReadiness(p.readinessConfig)
+	p.logSettings()
+	if p.softDeleteGrace > 0 {
+		var err error
+		p.softDelete, err = newSoftDeleter(p.softDeleteGrace, p.softDeleteFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("%s: soft delete: grace=%s , state=%q", ProviderName, p.softDeleteGrace, p.softDeleteFile)
+	}
+	if p.auditConfig.Path != "" {
+		var err error
+		p.audit, err = newAuditLog(p.auditConfig, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("%s: audit log: %+v", ProviderName, p.audit.cfg)
+	}
+	if p.journalConfig != nil {
+		var err error
+		p.journal, err = newJournal(*p.journalConfig)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("%s: journal: %+v", ProviderName, p.journal.cfg)
 	}
 
 	if apiUrl != "" {
@@ -84,19 +226,137 @@ func NewProvider(domainFilter endpoint.DomainFilter, apiUrl, apiKey string, dryR
 		}
 		p.client = newClient
 	}
+	if c, ok := p.client.(*gdns.Client); ok {
+		var refresh func(ctx context.Context, rejected string) error
+		if p.hasTokenSource() {
+			refresh = p.refreshRejected
+		}
+		if err := p.setupClient(c, p.credentials, refresh); err != nil {
+			return nil, err
+		}
+		log.Infof("%s: HTTP client: proxy=%q , caFile=%q , timeout=%s , userAgent=%q",
+			ProviderName, redactURL(p.httpClient.ProxyURL), p.httpClient.CAFile, c.HTTPClient.Timeout, c.UserAgent)
+	}
+	if len(p.accounts) > 0 {
+		var def dnsManager
+		if apiKey != "" {
+			def = p.client
+		}
+		router, err := p.newAccounts(def, apiUrl)
+		if err != nil {
+			return nil, err
+		}
+		p.client = router
+	}
+	p.metrics.setDryRun(p.dryRun)
+	p.client = &instrumentedClient{dnsManager: p.client, metrics: p.metrics}
+
+	bgCtx, cancel := context.WithCancel(context.Background())
+	p.stopBackground = cancel
+	if p.softDelete != nil && !p.dryRun {
+		go p.runJanitor(bgCtx)
+	}
+	if p.hasTokenSource() {
+		go p.watchToken(bgCtx)
+	}
 
 	return p, nil
 }
 
-func (p *DnsProvider) Records(rootCtx context.Context) ([]*endpoint.Endpoint, error) {
-	log.Infof("%s: Records: starting get records", ProviderName)
-	filters := p.GetDomainFilter().Filters
+// providerSettings are the settings Reload can change while requests are served
+type providerSettings struct {
+	domainFilter   endpoint.DomainFilter
+	listTimeout    time.Duration
+	applyTimeout   time.Duration
+	deletionLimits DeletionLimits
+	protection     ProtectionRules
+}
+
+func (p *DnsProvider) settings() providerSettings {
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	return providerSettings{
+		domainFilter:   p.domainFilter,
+		listTimeout:    p.listTimeout,
+		applyTimeout:   p.applyTimeout,
+		deletionLimits: p.deletionLimits,
+		protection:     p.protection,
+	}
+}
+
+func (p *DnsProvider) logSettings() {
+	s := p.settings()
+	log.Infof("%s: domain filter: %v", ProviderName, s.domainFilter.Filters)
+	log.Infof("%s: timeouts: list=%s , apply=%s , applyQueueLength=%d",
+		ProviderName, s.listTimeout, s.applyTimeout, p.locker.queueLength())
+	log.Infof("%s: deletion limits: %+v", ProviderName, s.deletionLimits)
+	log.Infof("%s: protected records: %s", ProviderName, s.protection)
+}
+
+// Reload replaces the domain filter, the API token, unless it is empty and read from a file or command,
+// and the settings of opts which can change
+// at runtime: timeouts, apply queue length, deletion limits and protection rules. Other
+// options need a restart and are ignored. Requests in flight are not interrupted and keep
+// the timeouts and limits they started with.
+func (p *DnsProvider) Reload(domainFilter endpoint.DomainFilter, apiKey string, opts ...Option) error {
+	if apiKey == "" && !p.hasTokenSource() && len(p.accounts) == 0 {
+		return EnvError("empty " + EnvAPIToken)
+	}
+	next := &DnsProvider{
+		domainFilter: domainFilter,
+		listTimeout:  defaultListTimeout,
+		applyTimeout: defaultApplyTimeout,
+		locker:       newZoneLocker(defaultApplyQueueLength),
+	}
+	for _, opt := range opts {
+		opt(next)
+	}
+	p.settingsMu.Lock()
+	p.domainFilter = next.domainFilter
+	p.listTimeout = next.listTimeout
+	p.applyTimeout = next.applyTimeout
+	p.deletionLimits = next.deletionLimits
+	p.protection = next.protection
+	p.settingsMu.Unlock()
+	p.locker.setQueueLength(next.locker.queueLength())
+	if apiKey != "" && p.credentials.set(apiKey) {
+		p.addSecret(apiKey)
+		log.Infof("%s: API token replaced", ProviderName)
+	}
+	log.Infof("%s: settings reloaded", ProviderName)
+	p.logSettings()
+	return nil
+}
+
+// Close stops background work of the provider
+func (p *DnsProvider) Close() {
+	if p.stopBackground != nil {
+		p.stopBackground()
+	}
+	if err := p.audit.Close(); err != nil {
+		log.Errorf("%s: close audit log: %v", ProviderName, err)
+	}
+}
+
+func (p *DnsProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	ctx, span := startSpan(ctx, "Records")
+	result, err := p.records(ctx)
+	span.SetAttributes(attribute.Int("dns.endpoints", len(result)))
+	endSpan(span, err)
+	return result, err
+}
+
+func (p *DnsProvider) records(rootCtx context.Context) ([]*endpoint.Endpoint, error) {
+	reqLog := logger(rootCtx)
+	reqLog.Infof("%s: Records: starting get records", ProviderName)
+	settings := p.settings()
+	ctx, cancel := p.withListTimeout(rootCtx)
+	defer cancel()
+	filters := domainFilterFromZones(p.managedZones(ctx)).Filters
 	if len(filters) == 0 {
 		filters = nil
 	}
-	log.Debugf("%s: Records: filters: len=%d %v", ProviderName, len(filters), filters)
-	ctx, cancel := p.ctxWithMyTimeout(rootCtx)
-	defer cancel()
+	reqLog.Debugf("%s: Records: filters: len=%d %v", ProviderName, len(filters), filters)
 	zs, err := p.client.AllZonesWithRecords(ctx, filters)
 	if err != nil {
 		return nil, fmt.Errorf("%s: records: %w", ProviderName, err)
@@ -111,31 +371,119 @@ func (p *DnsProvider) Records(rootCtx context.Context) ([]*endpoint.Endpoint, er
 				skipped++
 				continue
 			}
-			result = append(result,
-				endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), r.ShortAnswers...))
+			if settings.domainFilter.IsConfigured() && !settings.domainFilter.Match(r.Name) {
+				skipped++
+				continue
+			}
+			e := endpoint.NewEndpointWithTTL(r.Name, r.Type, endpoint.TTL(r.TTL), r.ShortAnswers...)
+			if p.softDelete != nil {
+				if e = p.softDelete.filterRecords(z.Name, e); e == nil {
+					skipped++
+					continue
+				}
+			}
+			result = append(result, e)
 		}
 	}
-	log.Debugf("%s: Records: ZonesWithRecords: zoneCount=%d %v", ProviderName, len(zoneCount), zoneCount)
-	defer log.Debugf("%s: Records: finishing get records: skipped=%d result=%d: %v", ProviderName, skipped, len(result), result)
+	reqLog.Debugf("%s: Records: ZonesWithRecords: zoneCount=%d %v", ProviderName, len(zoneCount), zoneCount)
+	result = settings.protection.filterRecords(result)
+	p.metrics.setZoneRecords(zs)
+	p.metrics.success("records")
+	p.readiness.recordsSucceeded()
+	defer reqLog.Debugf("%s: Records: finishing get records: skipped=%d result=%d: %v", ProviderName, skipped, len(result), result)
 	return result, nil
 }
 
-func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Changes) error {
+func (p *DnsProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	ctx, span := startSpan(ctx, "ApplyChanges",
+		attribute.Int("dns.changes.create", len(changes.Create)),
+		attribute.Int("dns.changes.update", len(changes.UpdateNew)),
+		attribute.Int("dns.changes.delete", len(changes.Delete)),
+		attribute.Bool("dns.dry_run", p.dryRun))
+	err := p.applyChanges(ctx, changes)
+	endSpan(span, err)
+	return err
+}
+
+func (p *DnsProvider) applyChanges(rootCtx context.Context, changes *plan.Changes) error {
+	reqLog := logger(rootCtx)
 	if !changes.HasChanges() {
+		p.metrics.success("apply_changes")
 		return nil
 	}
-	log.Infof("%s: ApplyChanges createLen=%d, deleteLen=%d, updateOldLen=%d, updateNewLen=%d",
+	settings := p.settings()
+	changes, err := settings.protection.filterChanges(changes)
+	if err != nil {
+		reqLog.Errorf("%s: ApplyChanges refused: %v", ProviderName, err)
+		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
+	}
+	if !changes.HasChanges() {
+		p.metrics.success("apply_changes")
+		return nil
+	}
+	reqLog.Infof("%s: ApplyChanges createLen=%d, deleteLen=%d, updateOldLen=%d, updateNewLen=%d",
 		ProviderName, len(changes.Create), len(changes.Delete), len(changes.UpdateOld), len(changes.UpdateNew))
-	ctx, cancel := p.ctxWithMyTimeout(rootCtx)
+	// an apply is not cancelled halfway when external-dns disconnects, the timeouts bound it
+	rootCtx = context.WithoutCancel(rootCtx)
+	listCtx, cancelList := p.withListTimeout(rootCtx)
+	zs, err := p.listManagedZones(listCtx)
+	cancelList()
+	if err != nil {
+		reqLog.Errorf("%s: ApplyChanges aborted, listing zones failed: %v", ProviderName, err)
+		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
+	}
+	ctx, cancel := p.withApplyTimeout(rootCtx)
 	defer cancel()
 	gr1, _ := errgroup.WithContext(ctx)
 	gr2, _ := errgroup.WithContext(ctx)
-	extractZone := p.zoneFromDNSNameGetter()
+	extractZone := zoneFromDNSNameGetter(zs)
+	audit := p.newAuditBatch(ctx, changes, extractZone)
+	defer audit.flush()
+	if err := settings.deletionLimits.check(changes, extractZone, zoneSizes(zs)); err != nil {
+		reqLog.Errorf("%s: ApplyChanges aborted before any change: %v", ProviderName, err)
+		audit.abort(err)
+		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
+	}
+	unlock, err := p.lockZones(ctx, changes, extractZone)
+	if err != nil {
+		audit.abort(err)
+		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
+	}
+	defer unlock()
+	// updates removing targets delete records as well
+	zones := make([]string, 0, len(changes.Delete))
+	for _, e := range changes.Delete {
+		zones = append(zones, extractZone(e.DNSName))
+	}
+	for _, e := range changes.UpdateOld {
+		if zone := extractZone(e.DNSName); zone != "" && removedTargets(e, changes.UpdateNew) > 0 {
+			zones = append(zones, zone)
+		}
+	}
+	if err = p.snapshotBeforeDelete(ctx, zones); err != nil {
+		reqLog.Errorf("%s: ApplyChanges aborted, snapshot failed: %v", ProviderName, err)
+		audit.abort(err)
+		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
+	}
+	journal, err := p.beginJournal(ctx, changes, extractZone)
+	if err != nil {
+		reqLog.Errorf("%s: ApplyChanges aborted before any change: %v", ProviderName, err)
+		audit.abort(err)
+		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
+	}
+	defer journal.commit(ctx)
 	appliedChanges := struct {
 		created uint
 		deleted uint
 		updated uint
 	}{}
+	// in dry-run mode RRSet operations are only planned, see DryRunPlan
+	var dryRun *dryRunPlanner
+	dryRunPrefix := ""
+	if p.dryRun {
+		dryRun = p.newDryRunPlanner(ctx)
+		dryRunPrefix = logDryRun
+	}
 	// prepare zone to add changes by removing outdated records
 	for _, d := range changes.UpdateNew {
 		d := d
@@ -150,22 +498,31 @@ func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Change
 			appliedChanges.updated++
 			msg := fmt.Sprintf("update old %s %s %s",
 				d.DNSName, d.RecordType, content)
-			if p.dryRun {
-				log.Info(logDryRun + msg)
-				continue
-			}
-			log.Debug(msg)
+			reqLog.Debug(dryRunPrefix + msg)
 			recordValues = append(recordValues, content)
 			errMsg = append(errMsg, msg)
 		}
 		if len(recordValues) == 0 {
 			continue
 		}
+		if dryRun != nil {
+			dryRun.deleteRecords(ctx, "update", zone, d.DNSName, d.RecordType, recordValues)
+			continue
+		}
 		gr2.Go(func() error {
+			if p.softDelete != nil {
+				err := errSafeWrap(strings.Join(errMsg, "; "),
+					p.softDelete.disable(ctx, p.client, zone, d.DNSName, d.RecordType, recordValues))
+				reqLog.Debugf("%s ApplyChanges.updateNew,SoftDelete: %s %s %v ERR=%v",
+					ProviderName, d.DNSName, d.RecordType, recordValues, err)
+				audit.fail("update", d.DNSName, d.RecordType, err)
+				return err
+			}
 			err := errSafeWrap(strings.Join(errMsg, "; "),
 				p.client.DeleteRRSetRecord(ctx, zone, d.DNSName, d.RecordType, recordValues...))
-			log.Debugf("%s ApplyChanges.updateNew,DeleteRRSetRecord: %s %s %v ERR=%v",
+			reqLog.Debugf("%s ApplyChanges.updateNew,DeleteRRSetRecord: %s %s %v ERR=%v",
 				ProviderName, d.DNSName, d.RecordType, recordValues, err)
+			audit.fail("update", d.DNSName, d.RecordType, err)
 			return err
 		})
 	}
@@ -182,19 +539,31 @@ func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Change
 			appliedChanges.deleted++
 			msg := fmt.Sprintf("delete %s %s %s",
 				d.DNSName, d.RecordType, content)
-			if p.dryRun {
-				log.Info(logDryRun + msg)
-				continue
-			}
-			log.Debug(msg)
+			reqLog.Debug(dryRunPrefix + msg)
 			recordValues = append(recordValues, content)
 			errMsg = append(errMsg, msg)
 		}
+		if len(recordValues) == 0 {
+			continue
+		}
+		if dryRun != nil {
+			dryRun.deleteRecords(ctx, "delete", zone, d.DNSName, d.RecordType, recordValues)
+			continue
+		}
 		gr1.Go(func() error {
+			if p.softDelete != nil {
+				err := errSafeWrap(strings.Join(errMsg, "; "),
+					p.softDelete.disable(ctx, p.client, zone, d.DNSName, d.RecordType, recordValues))
+				reqLog.Debugf("%s ApplyChanges.Delete,SoftDelete: %s %s %v ERR=%v",
+					ProviderName, d.DNSName, d.RecordType, recordValues, err)
+				audit.fail("delete", d.DNSName, d.RecordType, err)
+				return err
+			}
 			err := errSafeWrap(strings.Join(errMsg, "; "),
 				p.client.DeleteRRSetRecord(ctx, zone, d.DNSName, d.RecordType, recordValues...))
-			log.Debugf("%s ApplyChanges.Delete,DeleteRRSetRecord: %s %s %v ERR=%v",
+			reqLog.Debugf("%s ApplyChanges.Delete,DeleteRRSetRecord: %s %s %v ERR=%v",
 				ProviderName, d.DNSName, d.RecordType, recordValues, err)
+			audit.fail("delete", d.DNSName, d.RecordType, err)
 			return err
 		})
 	}
@@ -210,27 +579,34 @@ func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Change
 		for _, content := range c.Targets {
 			appliedChanges.created++
 			msg := fmt.Sprintf("create %s %s %s", c.DNSName, c.RecordType, content)
-			if p.dryRun {
-				log.Info(logDryRun + msg)
-				continue
-			}
-			log.Debug(msg)
+			reqLog.Debug(dryRunPrefix + msg)
 			rr := gdns.ResourceRecord{Enabled: true}
 			rr.SetContent(c.RecordType, content)
 			recordValues = append(recordValues, rr)
 			errMsg = append(errMsg, msg)
 		}
+		if len(recordValues) == 0 {
+			continue
+		}
+		if dryRun != nil {
+			dryRun.addRecords(ctx, "create", zone, c.DNSName, c.RecordType, recordValues, int(c.RecordTTL))
+			continue
+		}
 		gr1.Go(func() error {
 			err := errSafeWrap(strings.Join(errMsg, "; "),
-				p.client.AddZoneRRSet(ctx, zone, c.DNSName, c.RecordType, recordValues, int(c.RecordTTL)))
-			log.Debugf("%s ApplyChanges.Create,AddZoneRRSet: %s %s %v ERR=%v",
+				p.addRecords(ctx, zone, c.DNSName, c.RecordType, recordValues, int(c.RecordTTL)))
+			reqLog.Debugf("%s ApplyChanges.Create,AddZoneRRSet: %s %s %v ERR=%v",
 				ProviderName, c.DNSName, c.RecordType, recordValues, err)
+			audit.fail("create", c.DNSName, c.RecordType, err)
 			return err
 		})
 	}
 	// wait preparing before send updates to records
-	err := gr2.Wait()
+	err = gr2.Wait()
 	if err != nil {
+		// creates and deletes are already running, keep zones locked until they finish
+		_ = gr1.Wait()
+		audit.failAll("update", err)
 		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
 	}
 	// add changes
@@ -246,11 +622,7 @@ func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Change
 		for _, content := range unexistingTargets(c, changes.UpdateOld, true) {
 			appliedChanges.updated++
 			msg := fmt.Sprintf("update new %s %s %s", c.DNSName, c.RecordType, content)
-			if p.dryRun {
-				log.Info(logDryRun + msg)
-				continue
-			}
-			log.Debug(msg)
+			reqLog.Debug(dryRunPrefix + msg)
 			rr := gdns.ResourceRecord{Enabled: true}
 			rr.SetContent(c.RecordType, content)
 			recordValues = append(recordValues, rr)
@@ -259,11 +631,16 @@ func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Change
 		if len(recordValues) == 0 {
 			continue
 		}
+		if dryRun != nil {
+			dryRun.addRecords(ctx, "update", zone, c.DNSName, c.RecordType, recordValues, int(c.RecordTTL))
+			continue
+		}
 		gr1.Go(func() error {
 			err := errSafeWrap(strings.Join(errMsg, "; "),
-				p.client.AddZoneRRSet(ctx, zone, c.DNSName, c.RecordType, recordValues, int(c.RecordTTL)))
-			log.Debugf("%s ApplyChanges.UpdateNew,AddZoneRRSet: %s %s %v ERR=%v",
+				p.addRecords(ctx, zone, c.DNSName, c.RecordType, recordValues, int(c.RecordTTL)))
+			reqLog.Debugf("%s ApplyChanges.UpdateNew,AddZoneRRSet: %s %s %v ERR=%v",
 				ProviderName, c.DNSName, c.RecordType, recordValues, err)
+			audit.fail("update", c.DNSName, c.RecordType, err)
 			return err
 		})
 	}
@@ -271,16 +648,134 @@ func (p *DnsProvider) ApplyChanges(rootCtx context.Context, changes *plan.Change
 	if err != nil {
 		return fmt.Errorf("%s: apply changes: %w", ProviderName, err)
 	}
-	log.Infof("%s: finishing apply changes created=%d, deleted=%d, updated=%d",
+	if dryRun != nil {
+		p.dryRunPlans.store(dryRun.plan)
+		reqLog.Infof("%s: %splanned rrset operations=%d, errors=%d",
+			ProviderName, logDryRun, len(dryRun.plan.Operations), len(dryRun.plan.Errors))
+	} else {
+		p.metrics.addChanges("create", len(changes.Create))
+		p.metrics.addChanges("update", len(changes.UpdateNew))
+		p.metrics.addChanges("delete", len(changes.Delete))
+	}
+	p.metrics.success("apply_changes")
+	reqLog.Infof("%s: finishing apply changes created=%d, deleted=%d, updated=%d",
 		ProviderName, appliedChanges.created, appliedChanges.deleted, appliedChanges.updated)
 	return nil
 }
 
+// addRecords creates record values, soft-deleted ones are re-enabled instead
+func (p *DnsProvider) addRecords(ctx context.Context, zone, name, recordType string,
+	values []gdns.ResourceRecord, ttl int) error {
+	if p.softDelete != nil {
+		var err error
+		values, err = p.softDelete.restore(ctx, p.client, zone, name, recordType, values)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return nil
+		}
+	}
+	return p.client.AddZoneRRSet(ctx, zone, name, recordType, values, ttl)
+}
+
+// lockZone waits until no ApplyChanges works on the zone
+func (p *DnsProvider) lockZone(ctx context.Context, zone string) (func(), error) {
+	if p.locker == nil {
+		return func() {}, nil
+	}
+	return p.locker.lock(ctx, []string{zone})
+}
+
+// lockZones waits until no other ApplyChanges works on the zones touched by changes
+func (p *DnsProvider) lockZones(ctx context.Context, changes *plan.Changes,
+	extractZone func(name string) (zone string)) (func(), error) {
+	if p.locker == nil {
+		return func() {}, nil
+	}
+	ctx, span := startSpan(ctx, "LockZones")
+	defer span.End()
+	zones := make([]string, 0)
+	for _, eps := range [][]*endpoint.Endpoint{changes.Create, changes.UpdateNew, changes.Delete} {
+		for _, e := range eps {
+			zones = append(zones, extractZone(e.DNSName))
+		}
+	}
+	return p.locker.lock(ctx, zones)
+}
+
+// ApplyQueueDepth reports zones currently locked by ApplyChanges and how many applies wait for them
+func (p *DnsProvider) ApplyQueueDepth() map[string]ZoneQueue {
+	if p.locker == nil {
+		return map[string]ZoneQueue{}
+	}
+	return p.locker.depth()
+}
+
 func (p *DnsProvider) GetDomainFilter() endpoint.DomainFilter {
-	log.Debugf("%s: GetDomainFilter", ProviderName)
-	zs, err := p.client.AllZonesWithRecords(context.Background(), nil)
+	ctx, cancel := p.withListTimeout(context.Background())
+	defer cancel()
+	return p.DomainFilterContext(ctx)
+}
+
+// DomainFilterContext is GetDomainFilter bound to the caller's context,
+// so the zone listing is cancelled together with the incoming request.
+// A configured domain filter is returned as is, otherwise all zones of the account are managed.
+func (p *DnsProvider) DomainFilterContext(ctx context.Context) endpoint.DomainFilter {
+	if domainFilter := p.settings().domainFilter; domainFilter.IsConfigured() {
+		return domainFilter
+	}
+	return domainFilterFromZones(p.managedZones(ctx))
+}
+
+// managedZones lists zones with records, on error it is logged and no zone is managed
+func (p *DnsProvider) managedZones(ctx context.Context) []gdns.Zone {
+	zs, err := p.listManagedZones(ctx)
+	if err != nil {
+		logger(ctx).Errorf("%s: ERROR GetDomainFilter: %v", ProviderName, err)
+		return nil
+	}
+	return zs
+}
+
+// listManagedZones lists the zones with records the domain filter selects
+func (p *DnsProvider) listManagedZones(ctx context.Context) ([]gdns.Zone, error) {
+	logger(ctx).Debugf("%s: GetDomainFilter", ProviderName)
+	ctx, span := startSpan(ctx, "ManagedZones")
+	zs, err := p.client.AllZonesWithRecords(ctx, nil)
+	endSpan(span, err)
 	if err != nil {
-		log.Errorf("%s: ERROR GetDomainFilter: %v", ProviderName, err)
+		return nil, err
+	}
+	domainFilter := p.settings().domainFilter
+	if !domainFilter.IsConfigured() {
+		return zs, nil
+	}
+	res := make([]gdns.Zone, 0, len(zs))
+	for _, z := range zs {
+		if managesZone(domainFilter, z.Name) {
+			res = append(res, z)
+		}
+	}
+	return res, nil
+}
+
+// managesZone tells if the domain filter selects the zone or a domain inside it
+func managesZone(domainFilter endpoint.DomainFilter, zone string) bool {
+	if !domainFilter.IsConfigured() || domainFilter.Match(zone) {
+		return true
+	}
+	zone = normalizeName(zone)
+	for _, f := range domainFilter.Filters {
+		if f = normalizeName(f); f == zone || strings.HasSuffix(f, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+func domainFilterFromZones(zs []gdns.Zone) endpoint.DomainFilter {
+	if zs == nil {
 		return endpoint.DomainFilter{}
 	}
 	domains := make([]string, 0)
@@ -308,11 +803,10 @@ func (p *DnsProvider) PropertyValuesEqual(_ string, previous string, current str
 	return previous == current
 }
 
-func (p *DnsProvider) zoneFromDNSNameGetter() func(name string) (zone string) {
-	existingZones := p.GetDomainFilter()
+func zoneFromDNSNameGetter(zs []gdns.Zone) func(name string) (zone string) {
 	search := make(map[string]string)
-	for _, zone := range existingZones.Filters {
-		search[zone] = strings.Trim(zone, ".")
+	for _, z := range zs {
+		search[strings.Trim(z.Name, ".")] = strings.Trim(z.Name, ".")
 	}
 	return func(name string) (zone string) {
 		for _, possibleZone := range extractAllZones(name) {
@@ -324,21 +818,22 @@ func (p *DnsProvider) zoneFromDNSNameGetter() func(name string) (zone string) {
 	}
 }
 
-func (p *DnsProvider) ctxWithMyTimeout(rootCtx context.Context) (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithTimeout(context.Background(), maxTimeout)
-	go func() {
-		select {
-		case <-rootCtx.Done():
-			ctxErr := rootCtx.Err()
-			if ctxErr != nil && strings.Contains(ctxErr.Error(), "deadline exceeded") {
-				return
-			}
-			log.Warningf("%s: ctx done: %v", ProviderName, ctxErr)
-			cancel()
-		case <-ctx.Done():
-		}
-	}()
-	return ctx, cancel
+// withListTimeout derives a context for read operations; the parent's
+// deadline and cancellation still apply when they are shorter.
+func (p *DnsProvider) withListTimeout(rootCtx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(rootCtx, p.settings().listTimeout, defaultListTimeout)
+}
+
+// withApplyTimeout derives a context for write operations.
+func (p *DnsProvider) withApplyTimeout(rootCtx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(rootCtx, p.settings().applyTimeout, defaultApplyTimeout)
+}
+
+func withTimeout(rootCtx context.Context, timeout, fallback time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = fallback
+	}
+	return context.WithTimeout(rootCtx, timeout)
 }
 
 func extractAllZones(dnsName string) []string {
@@ -409,3 +904,18 @@ type EnvError string
 func (e EnvError) Error() string {
 	return fmt.Sprintf("invalid environment var: %s", string(e))
 }
+
+// readRRSet returns the RRSet, nil when it does not exist or has no records
+func (p *DnsProvider) readRRSet(ctx context.Context, zone, name, recordType string) (*gdns.RRSet, error) {
+	rrSet, err := p.client.RRSet(ctx, zone, name, recordType)
+	apiErr := new(gdns.APIError)
+	switch {
+	case err != nil && errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case len(rrSet.Records) == 0:
+		return nil, nil
+	}
+	return &rrSet, nil
+}
@@ -15,9 +15,16 @@ package gcoreprovider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	gdns "github.com/G-Core/gcore-dns-sdk-go"
 	"sigs.k8s.io/external-dns/endpoint"
@@ -28,6 +35,11 @@ type dnsManagerMock struct {
 	addZoneRRSet      func(ctx context.Context, zone, recordName, recordType string, values []gdns.ResourceRecord, ttl int) error
 	zonesWithRecords  func(ctx context.Context, filters []string) ([]gdns.Zone, error)
 	deleteRRSetRecord func(ctx context.Context, zone, name, recordType string, contents ...string) error
+	rrSet             func(ctx context.Context, zone, name, recordType string) (gdns.RRSet, error)
+	updateRRSet       func(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error
+	createRRSet       func(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error
+	deleteRRSet       func(ctx context.Context, zone, name, recordType string) error
+	zonesWithParam    func(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error)
 }
 
 func (d dnsManagerMock) AddZoneRRSet(ctx context.Context,
@@ -38,9 +50,24 @@ func (d dnsManagerMock) AddZoneRRSet(ctx context.Context,
 func (d dnsManagerMock) AllZonesWithRecords(ctx context.Context, filters []string) ([]gdns.Zone, error) {
 	return d.zonesWithRecords(ctx, filters)
 }
+func (d dnsManagerMock) CreateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	return d.createRRSet(ctx, zone, name, recordType, record)
+}
+func (d dnsManagerMock) DeleteRRSet(ctx context.Context, zone, name, recordType string) error {
+	return d.deleteRRSet(ctx, zone, name, recordType)
+}
+func (d dnsManagerMock) ZonesWithParam(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+	return d.zonesWithParam(ctx, param)
+}
 func (d dnsManagerMock) DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error {
 	return d.deleteRRSetRecord(ctx, zone, name, recordType, contents...)
 }
+func (d dnsManagerMock) RRSet(ctx context.Context, zone, name, recordType string) (gdns.RRSet, error) {
+	return d.rrSet(ctx, zone, name, recordType)
+}
+func (d dnsManagerMock) UpdateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	return d.updateRRSet(ctx, zone, name, recordType, record)
+}
 
 func Test_dnsProvider_Records(t *testing.T) {
 	type fields struct {
@@ -530,3 +557,294 @@ func TestNonExistingTargets(t *testing.T) {
 		})
 	}
 }
+
+func Test_dnsProvider_timeouts(t *testing.T) {
+	var gotDeadline time.Duration
+	p := &DnsProvider{
+		client: dnsManagerMock{
+			zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				deadline, _ := ctx.Deadline()
+				gotDeadline = time.Until(deadline)
+				return []gdns.Zone{}, nil
+			},
+		},
+	}
+	WithTimeouts(2*time.Minute, 0)(p)
+	if p.listTimeout != 2*time.Minute || p.applyTimeout != 0 {
+		t.Fatalf("WithTimeouts() list = %v, apply = %v", p.listTimeout, p.applyTimeout)
+	}
+	if _, err := p.Records(context.Background()); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if gotDeadline <= time.Minute || gotDeadline > 2*time.Minute {
+		t.Errorf("Records() deadline = %v, want ~2m", gotDeadline)
+	}
+	// shorter parent deadline wins
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if gotDeadline > time.Second {
+		t.Errorf("Records() deadline = %v, want <= 1s", gotDeadline)
+	}
+	// cancelled parent is propagated to the client
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.Records(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Records() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_listing(t *testing.T) {
+	var listErr error
+	added := 0
+	p := &DnsProvider{
+		client: dnsManagerMock{
+			zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+				time.Sleep(50 * time.Millisecond)
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return []gdns.Zone{{Name: "test.com"}}, listErr
+			},
+			addZoneRRSet: func(ctx context.Context, zone, recordName, recordType string, values []gdns.ResourceRecord, ttl int) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				added++
+				return nil
+			},
+		},
+		locker: newZoneLocker(defaultApplyQueueLength),
+	}
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 10, "1.1.1.1")}}
+
+	// the zone listing is bound by the list timeout, not the shorter apply timeout
+	WithTimeouts(time.Second, 10*time.Millisecond)(p)
+	if err := p.ApplyChanges(context.Background(), changes); err != nil || added != 1 {
+		t.Fatalf("ApplyChanges() error = %v, added = %d", err, added)
+	}
+
+	// a disconnected client doesn't cancel the apply
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	WithTimeouts(time.Second, time.Second)(p)
+	if err := p.ApplyChanges(ctx, changes); err != nil || added != 2 {
+		t.Fatalf("ApplyChanges() of a cancelled request error = %v, added = %d", err, added)
+	}
+
+	// a failed listing fails the apply instead of skipping every change
+	listErr = errors.New("api down")
+	if err := p.ApplyChanges(context.Background(), changes); err == nil || added != 2 {
+		t.Errorf("ApplyChanges() error = %v, added = %d, want the listing error", err, added)
+	}
+	WithTimeouts(10*time.Millisecond, time.Second)(p)
+	listErr = nil
+	if err := p.ApplyChanges(context.Background(), changes); !errors.Is(err, context.DeadlineExceeded) || added != 2 {
+		t.Errorf("ApplyChanges() error = %v, added = %d, want the list timeout", err, added)
+	}
+}
+
+// memoryDNS is a stateful dnsManager keeping RRSets in memory
+type memoryDNS struct {
+	mu     sync.Mutex
+	zones  []string
+	rrSets map[string]gdns.RRSet
+}
+
+func newMemoryDNS(zones ...string) *memoryDNS {
+	return &memoryDNS{zones: zones, rrSets: map[string]gdns.RRSet{}}
+}
+
+func memoryKey(zone, name, recordType string) string {
+	return strings.Join([]string{strings.Trim(zone, "."), strings.Trim(name, "."), recordType}, "/")
+}
+
+func (m *memoryDNS) AddZoneRRSet(_ context.Context, zone, recordName, recordType string,
+	values []gdns.ResourceRecord, ttl int, _ ...gdns.AddZoneOpt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(zone, recordName, recordType)
+	rrSet := m.rrSets[key]
+	rrSet.Type, rrSet.TTL = recordType, ttl
+	for _, v := range values {
+		v.Content = []any{v.ContentToString()}
+		rrSet.Records = append(rrSet.Records, v)
+	}
+	m.rrSets[key] = rrSet
+	return nil
+}
+
+func (m *memoryDNS) AllZonesWithRecords(_ context.Context, _ []string) ([]gdns.Zone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]gdns.Zone, 0, len(m.zones))
+	for _, zone := range m.zones {
+		z := gdns.Zone{Name: zone}
+		keys := make([]string, 0, len(m.rrSets))
+		for key := range m.rrSets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			parts := strings.Split(key, "/")
+			if parts[0] != zone {
+				continue
+			}
+			rrSet := m.rrSets[key]
+			answers := make([]string, 0, len(rrSet.Records))
+			for _, r := range rrSet.Records {
+				answers = append(answers, r.ContentToString())
+			}
+			z.Records = append(z.Records, gdns.ZoneRecord{
+				Name: parts[1], Type: parts[2], TTL: uint(rrSet.TTL), ShortAnswers: answers})
+		}
+		res = append(res, z)
+	}
+	return res, nil
+}
+
+func (m *memoryDNS) DeleteRRSetRecord(_ context.Context, zone, name, recordType string, contents ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(zone, name, recordType)
+	rrSet, ok := m.rrSets[key]
+	if !ok {
+		return nil
+	}
+	records := make([]gdns.ResourceRecord, 0, len(rrSet.Records))
+	for _, r := range rrSet.Records {
+		found := false
+		for _, c := range contents {
+			found = found || c == r.ContentToString()
+		}
+		if !found {
+			records = append(records, r)
+		}
+	}
+	rrSet.Records = records
+	if len(records) == 0 {
+		delete(m.rrSets, key)
+		return nil
+	}
+	m.rrSets[key] = rrSet
+	return nil
+}
+
+func (m *memoryDNS) RRSet(_ context.Context, zone, name, recordType string) (gdns.RRSet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rrSet, ok := m.rrSets[memoryKey(zone, name, recordType)]
+	if !ok {
+		return gdns.RRSet{}, gdns.APIError{StatusCode: http.StatusNotFound, Message: "not found"}
+	}
+	rrSet.Records = append([]gdns.ResourceRecord{}, rrSet.Records...)
+	return rrSet, nil
+}
+
+func (m *memoryDNS) UpdateRRSet(_ context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rrSets[memoryKey(zone, name, recordType)] = record
+	return nil
+}
+
+func (m *memoryDNS) CreateRRSet(_ context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(zone, name, recordType)
+	if _, ok := m.rrSets[key]; ok {
+		return gdns.APIError{StatusCode: http.StatusConflict, Message: "already exists"}
+	}
+	m.rrSets[key] = record
+	return nil
+}
+
+func (m *memoryDNS) DeleteRRSet(_ context.Context, zone, name, recordType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rrSets, memoryKey(zone, name, recordType))
+	return nil
+}
+
+func (m *memoryDNS) ZonesWithParam(_ context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := gdns.ListZones{TotalAmount: len(m.zones)}
+	for i, zone := range m.zones {
+		if uint64(i) < param.Offset {
+			continue
+		}
+		if param.Limit > 0 && uint64(len(res.Zones)) >= param.Limit {
+			break
+		}
+		res.Zones = append(res.Zones, gdns.Zone{Name: zone})
+	}
+	return res, nil
+}
+
+func Test_dnsProvider_domainFilter(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryDNS("example.com", "test.com")
+	for name, zone := range map[string]string{
+		"a.sub.example.com": "example.com", "b.example.com": "example.com", "c.test.com": "test.com"} {
+		_ = client.AddZoneRRSet(ctx, zone, name, "A", []gdns.ResourceRecord{
+			*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+		}, 10)
+	}
+	p := &DnsProvider{client: client, domainFilter: endpoint.NewDomainFilter([]string{"sub.example.com"})}
+	if got := p.DomainFilterContext(ctx).Filters; !reflect.DeepEqual(got, []string{"sub.example.com"}) {
+		t.Errorf("DomainFilterContext() = %v", got)
+	}
+	if zs := p.managedZones(ctx); len(zs) != 1 || zs[0].Name != "example.com" {
+		t.Errorf("managedZones() = %+v, want example.com only", zs)
+	}
+	records, err := p.Records(ctx)
+	if err != nil || len(records) != 1 || records[0].DNSName != "a.sub.example.com" {
+		t.Errorf("Records() = %v, %v", records, err)
+	}
+}
+
+func Test_dnsProvider_Reload(t *testing.T) {
+	auth := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer srv.Close()
+	p, err := NewProvider(endpoint.NewDomainFilter([]string{"example.com"}), srv.URL, "old-token", false,
+		WithTimeouts(time.Minute, time.Minute), WithApplyQueueLength(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx := context.Background()
+	if _, err = p.client.ZonesWithParam(ctx, gdns.ZonesParam{Limit: 1}); err != nil || auth != "APIKey old-token" {
+		t.Fatalf("Authorization = %q, %v", auth, err)
+	}
+	rules, _ := NewProtectionRules([]string{"*/MX"})
+	if err = p.Reload(endpoint.NewDomainFilter([]string{"test.com"}), "", WithProtectionRules(rules)); err == nil {
+		t.Fatal("Reload() must reject an empty token")
+	}
+	if err = p.Reload(endpoint.NewDomainFilter([]string{"test.com"}), "new-token",
+		WithTimeouts(2*time.Minute, 0), WithProtectionRules(rules)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.client.ZonesWithParam(ctx, gdns.ZonesParam{Limit: 1}); err != nil || auth != "APIKey new-token" {
+		t.Errorf("Authorization after reload = %q, %v", auth, err)
+	}
+	s := p.settings()
+	if !reflect.DeepEqual(s.domainFilter.Filters, []string{"test.com"}) || s.protection.String() != rules.String() {
+		t.Errorf("settings after reload = %+v", s)
+	}
+	if s.listTimeout != 2*time.Minute || s.applyTimeout != defaultApplyTimeout {
+		t.Errorf("timeouts after reload = %s, %s", s.listTimeout, s.applyTimeout)
+	}
+	if n := p.locker.queueLength(); n != defaultApplyQueueLength {
+		t.Errorf("apply queue length after reload = %d", n)
+	}
+}
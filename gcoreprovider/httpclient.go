@@ -0,0 +1,96 @@
+package gcoreprovider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+)
+
+// DefaultUserAgent is sent to the Gcore API unless HTTPClientConfig.UserAgent is set
+const DefaultUserAgent = "external-dns-gcore-webhook"
+
+// HTTPClientConfig tunes the HTTP client used for the Gcore API, zero values keep the defaults
+type HTTPClientConfig struct {
+	// ProxyURL e.g. "http://proxy:3128", HTTPS_PROXY and NO_PROXY apply when empty
+	ProxyURL string
+	// CAFile is a PEM bundle trusted in addition to the system roots, e.g. of a TLS-inspecting proxy
+	CAFile string
+	// Timeout bounds a single request including the response body, 10s when zero
+	Timeout             time.Duration
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	IdleConnTimeout     time.Duration
+	UserAgent           string
+}
+
+// newTransport clones http.DefaultTransport with cfg applied
+func newTransport(cfg HTTPClientConfig) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("%s: invalid proxy URL %q", ProviderName, cfg.ProxyURL)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: read CA file: %w", ProviderName, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificate found in CA file %s", ProviderName, cfg.CAFile)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	if cfg.DialTimeout > 0 {
+		t.DialContext = (&net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	return t, nil
+}
+
+// redactURL hides the password of a proxy URL
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// configureHTTPClient applies cfg to c, auth and tracing are wrapped around its transport afterwards
+func configureHTTPClient(c *gdns.Client, cfg HTTPClientConfig) error {
+	t, err := newTransport(cfg)
+	if err != nil {
+		return err
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
+	}
+	c.HTTPClient.Transport = t
+	if cfg.Timeout > 0 {
+		c.HTTPClient.Timeout = cfg.Timeout
+	}
+	c.UserAgent = cfg.UserAgent
+	if c.UserAgent == "" {
+		c.UserAgent = DefaultUserAgent
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestNewProvider_httpClientCA(t *testing.T) {
+	userAgent := ""
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, bundle, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	p, err := NewProvider(endpoint.DomainFilter{}, srv.URL, "token", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.client.ZonesWithParam(ctx, gdns.ZonesParam{Limit: 1}); err == nil {
+		t.Error("a server signed by an unknown CA must be rejected")
+	}
+
+	p, err = NewProvider(endpoint.DomainFilter{}, srv.URL, "token", false, WithHTTPClient(HTTPClientConfig{
+		CAFile:      caFile,
+		Timeout:     5 * time.Second,
+		DialTimeout: time.Second,
+		UserAgent:   "external-dns-gcore-webhook/v1.2.3",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.client.ZonesWithParam(ctx, gdns.ZonesParam{Limit: 1}); err != nil {
+		t.Fatalf("ZonesWithParam() with CAFile error = %v", err)
+	}
+	if userAgent != "external-dns-gcore-webhook/v1.2.3" {
+		t.Errorf("User-Agent = %q", userAgent)
+	}
+}
+
+func TestNewProvider_httpClientProxy(t *testing.T) {
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer proxy.Close()
+	p, err := NewProvider(endpoint.DomainFilter{}, "http://api.gcore.invalid/dns", "token", false,
+		WithHTTPClient(HTTPClientConfig{ProxyURL: proxy.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.client.ZonesWithParam(context.Background(), gdns.ZonesParam{Limit: 1}); err != nil {
+		t.Fatalf("ZonesWithParam() error = %v", err)
+	}
+	if proxied != "http://api.gcore.invalid/dns/v2/zones?limit=1" {
+		t.Errorf("proxy got %q", proxied)
+	}
+}
+
+func TestNewProvider_httpClientInvalid(t *testing.T) {
+	for _, cfg := range []HTTPClientConfig{
+		{ProxyURL: "proxy:3128"},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := NewProvider(endpoint.DomainFilter{}, "", "token", false, WithHTTPClient(cfg)); err == nil {
+			t.Errorf("NewProvider(%+v) must fail", cfg)
+		}
+	}
+}
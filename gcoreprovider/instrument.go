@@ -0,0 +1,86 @@
+package gcoreprovider
+
+import (
+	"context"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// instrumentedClient records metrics and spans of Gcore API calls of the wrapped dnsManager
+type instrumentedClient struct {
+	dnsManager
+	metrics *Metrics
+}
+
+// start opens the span of operation, the returned func finishes it with the call result
+func (c *instrumentedClient) start(ctx context.Context, operation string,
+	attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	started := time.Now()
+	ctx, span := startSpan(ctx, "gcore."+operation, attrs...)
+	return ctx, func(err error) {
+		c.metrics.observeAPICall(operation, started, err)
+		if err != nil {
+			span.SetAttributes(attribute.String("error.class", errorClass(err)))
+		}
+		endSpan(span, err)
+	}
+}
+
+func (c *instrumentedClient) AddZoneRRSet(ctx context.Context, zone, recordName, recordType string,
+	values []gdns.ResourceRecord, ttl int, opts ...gdns.AddZoneOpt) error {
+	ctx, done := c.start(ctx, "add_zone_rrset", rrSetAttrs(zone, recordName, recordType)...)
+	err := c.dnsManager.AddZoneRRSet(ctx, zone, recordName, recordType, values, ttl, opts...)
+	done(err)
+	return err
+}
+
+func (c *instrumentedClient) AllZonesWithRecords(ctx context.Context, nameFilters []string) ([]gdns.Zone, error) {
+	ctx, done := c.start(ctx, "all_zones_with_records", attribute.StringSlice("dns.zone_filters", nameFilters))
+	zs, err := c.dnsManager.AllZonesWithRecords(ctx, nameFilters)
+	done(err)
+	return zs, err
+}
+
+func (c *instrumentedClient) CreateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	ctx, done := c.start(ctx, "create_rrset", rrSetAttrs(zone, name, recordType)...)
+	err := c.dnsManager.CreateRRSet(ctx, zone, name, recordType, record)
+	done(err)
+	return err
+}
+
+func (c *instrumentedClient) DeleteRRSet(ctx context.Context, zone, name, recordType string) error {
+	ctx, done := c.start(ctx, "delete_rrset", rrSetAttrs(zone, name, recordType)...)
+	err := c.dnsManager.DeleteRRSet(ctx, zone, name, recordType)
+	done(err)
+	return err
+}
+
+func (c *instrumentedClient) DeleteRRSetRecord(ctx context.Context, zone, name, recordType string, contents ...string) error {
+	ctx, done := c.start(ctx, "delete_rrset_record", rrSetAttrs(zone, name, recordType)...)
+	err := c.dnsManager.DeleteRRSetRecord(ctx, zone, name, recordType, contents...)
+	done(err)
+	return err
+}
+
+func (c *instrumentedClient) RRSet(ctx context.Context, zone, name, recordType string) (gdns.RRSet, error) {
+	ctx, done := c.start(ctx, "rrset", rrSetAttrs(zone, name, recordType)...)
+	rrSet, err := c.dnsManager.RRSet(ctx, zone, name, recordType)
+	done(err)
+	return rrSet, err
+}
+
+func (c *instrumentedClient) ZonesWithParam(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+	ctx, done := c.start(ctx, "zones", attribute.Int64("gcore.offset", int64(param.Offset)))
+	res, err := c.dnsManager.ZonesWithParam(ctx, param)
+	done(err)
+	return res, err
+}
+
+func (c *instrumentedClient) UpdateRRSet(ctx context.Context, zone, name, recordType string, record gdns.RRSet) error {
+	ctx, done := c.start(ctx, "update_rrset", rrSetAttrs(zone, name, recordType)...)
+	err := c.dnsManager.UpdateRRSet(ctx, zone, name, recordType, record)
+	done(err)
+	return err
+}
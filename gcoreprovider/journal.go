@@ -0,0 +1,320 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const defaultJournalSize = 100
+
+var (
+	// ErrJournalEntryNotFound returned when undo asks for an unknown apply
+	ErrJournalEntryNotFound = errors.New("journal entry not found")
+	// ErrJournalConflict returned when records changed after the apply or it was already undone
+	ErrJournalConflict = errors.New("journal conflict")
+	// ErrJournalDisabled returned when the journal is not configured
+	ErrJournalDisabled = errors.New("journal is not configured")
+)
+
+// JournalEntry is a single ApplyChanges with the RRSet state before and after it
+type JournalEntry struct {
+	ID         uint64             `json:"id"`
+	RequestID  string             `json:"requestId,omitempty"`
+	AppliedAt  time.Time          `json:"appliedAt"`
+	UndoneAt   *time.Time         `json:"undoneAt,omitempty"`
+	Operations []JournalOperation `json:"operations"`
+}
+
+// JournalOperation is the change of one RRSet, Before is nil when the apply
+// created it and After is nil when the apply deleted it.
+type JournalOperation struct {
+	Zone   string      `json:"zone"`
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Before *gdns.RRSet `json:"before"`
+	After  *gdns.RRSet `json:"after"`
+}
+
+// inverse returns the operation putting the RRSet back to Before
+func (o JournalOperation) inverse() RRSetOperation {
+	op := RRSetOperation{Change: "undo", Zone: o.Zone, Name: o.Name, Type: o.Type, Before: o.After, After: o.Before}
+	switch {
+	case o.Before == nil:
+		op.Operation = OperationDeleteRRSet
+	case o.After == nil:
+		op.Operation = OperationCreateRRSet
+	default:
+		op.Operation = OperationUpdateRRSet
+	}
+	return op
+}
+
+// JournalConfig keeps the last Size applies, in File between restarts when set
+type JournalConfig struct {
+	Size int
+	File string
+}
+
+type journal struct {
+	cfg     JournalConfig
+	mu      sync.Mutex
+	entries []JournalEntry
+	lastID  uint64
+}
+
+func newJournal(cfg JournalConfig) (*journal, error) {
+	if cfg.Size <= 0 {
+		cfg.Size = defaultJournalSize
+	}
+	j := &journal{cfg: cfg, entries: []JournalEntry{}}
+	if cfg.File == "" {
+		return j, nil
+	}
+	bs, err := os.ReadFile(cfg.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	if err = json.Unmarshal(bs, &j.entries); err != nil {
+		return nil, fmt.Errorf("decode journal %s: %w", cfg.File, err)
+	}
+	for _, e := range j.entries {
+		if e.ID > j.lastID {
+			j.lastID = e.ID
+		}
+	}
+	return j, nil
+}
+
+func (j *journal) add(entry JournalEntry) uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastID++
+	entry.ID = j.lastID
+	j.entries = append(j.entries, entry)
+	if len(j.entries) > j.cfg.Size {
+		j.entries = j.entries[len(j.entries)-j.cfg.Size:]
+	}
+	j.save()
+	return entry.ID
+}
+
+func (j *journal) get(id uint64) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, e := range j.entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return JournalEntry{}, false
+}
+
+func (j *journal) markUndone(id uint64, at time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := range j.entries {
+		if j.entries[i].ID == id {
+			j.entries[i].UndoneAt = &at
+		}
+	}
+	j.save()
+}
+
+// list returns entries, newest first
+func (j *journal) list() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	res := make([]JournalEntry, 0, len(j.entries))
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		res = append(res, j.entries[i])
+	}
+	return res
+}
+
+// save writes the journal file, must be called with mu held
+func (j *journal) save() {
+	if j.cfg.File == "" {
+		return
+	}
+	bs, err := json.Marshal(j.entries)
+	if err == nil {
+		tmp := j.cfg.File + ".tmp"
+		if err = os.WriteFile(tmp, bs, 0o600); err == nil {
+			err = os.Rename(tmp, j.cfg.File)
+		}
+	}
+	if err != nil {
+		log.Errorf("%s: save journal %s: %v", ProviderName, j.cfg.File, err)
+	}
+}
+
+// journalRecorder remembers RRSets touched by one ApplyChanges before it writes
+type journalRecorder struct {
+	p      *DnsProvider
+	entry  JournalEntry
+	before map[string]*gdns.RRSet
+	refs   map[string]JournalOperation
+}
+
+// beginJournal reads every RRSet touched by changes, nil when the journal is off
+func (p *DnsProvider) beginJournal(ctx context.Context, changes *plan.Changes,
+	extractZone func(name string) (zone string)) (*journalRecorder, error) {
+	if p.journal == nil || p.dryRun {
+		return nil, nil
+	}
+	r := &journalRecorder{
+		p:      p,
+		entry:  JournalEntry{RequestID: RequestID(ctx), AppliedAt: time.Now().UTC()},
+		before: map[string]*gdns.RRSet{},
+		refs:   map[string]JournalOperation{},
+	}
+	for _, eps := range [][]*endpoint.Endpoint{changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete} {
+		for _, e := range eps {
+			zone := extractZone(e.DNSName)
+			if zone == "" {
+				continue
+			}
+			name := strings.Trim(e.DNSName, ".")
+			r.refs[rrSetKey(name, e.RecordType)] = JournalOperation{Zone: zone, Name: name, Type: e.RecordType}
+		}
+	}
+	var mu sync.Mutex
+	gr, grCtx := errgroup.WithContext(ctx)
+	gr.SetLimit(snapshotConcurrency)
+	for key, ref := range r.refs {
+		key, ref := key, ref
+		gr.Go(func() error {
+			rrSet, err := p.readRRSet(grCtx, ref.Zone, ref.Name, ref.Type)
+			if err != nil {
+				return fmt.Errorf("journal: %s %s: %w", ref.Name, ref.Type, err)
+			}
+			mu.Lock()
+			r.before[key] = rrSet
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := gr.Wait(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// commit reads the RRSets again and stores the entry when anything changed
+func (r *journalRecorder) commit(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	// the apply context may be already cancelled, the state must still be recorded
+	ctx, cancel := r.p.withListTimeout(context.WithoutCancel(ctx))
+	defer cancel()
+	keys := make([]string, 0, len(r.refs))
+	for key := range r.refs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		op := r.refs[key]
+		after, err := r.p.readRRSet(ctx, op.Zone, op.Name, op.Type)
+		if err != nil {
+			log.Errorf("%s: journal: %s %s: %v, this apply can not be undone", ProviderName, op.Name, op.Type, err)
+			return
+		}
+		op.Before, op.After = r.before[key], after
+		if op.Before == nil && op.After == nil ||
+			op.Before != nil && op.After != nil && sameRRSet(*op.Before, *op.After) {
+			continue
+		}
+		r.entry.Operations = append(r.entry.Operations, op)
+	}
+	if len(r.entry.Operations) == 0 {
+		return
+	}
+	id := r.p.journal.add(r.entry)
+	log.Infof("%s: journal: recorded apply %d with %d RRSet operations", ProviderName, id, len(r.entry.Operations))
+}
+
+// Journal lists recent applies, newest first
+func (p *DnsProvider) Journal() ([]JournalEntry, error) {
+	if p.journal == nil {
+		return nil, fmt.Errorf("%s: %w", ProviderName, ErrJournalDisabled)
+	}
+	return p.journal.list(), nil
+}
+
+// Undo reverts the apply id if its RRSets still hold the values it wrote,
+// with dryRun the returned operations are only planned.
+func (p *DnsProvider) Undo(rootCtx context.Context, id uint64, dryRun bool) ([]RRSetOperation, error) {
+	if p.journal == nil {
+		return nil, fmt.Errorf("%s: %w", ProviderName, ErrJournalDisabled)
+	}
+	entry, ok := p.journal.get(id)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w: %d", ProviderName, ErrJournalEntryNotFound, id)
+	}
+	if entry.UndoneAt != nil {
+		return nil, fmt.Errorf("%s: %w: apply %d was undone at %s", ProviderName, ErrJournalConflict, id, entry.UndoneAt)
+	}
+	ctx, span := startSpan(rootCtx, "Undo", attribute.Int64("journal.id", int64(id)), attribute.Bool("dns.dry_run", dryRun))
+	defer span.End()
+	ctx, cancel := p.withApplyTimeout(ctx)
+	defer cancel()
+	zones := make([]string, 0, len(entry.Operations))
+	for _, op := range entry.Operations {
+		zones = append(zones, op.Zone)
+	}
+	if p.locker != nil {
+		unlock, err := p.locker.lock(ctx, zones)
+		if err != nil {
+			return nil, fmt.Errorf("%s: undo: %w", ProviderName, err)
+		}
+		defer unlock()
+	}
+	ops := make([]RRSetOperation, 0, len(entry.Operations))
+	for i := len(entry.Operations) - 1; i >= 0; i-- {
+		op := entry.Operations[i]
+		current, err := p.readRRSet(ctx, op.Zone, op.Name, op.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s: undo %d: %s %s: %w", ProviderName, id, op.Name, op.Type, err)
+		}
+		if (current == nil) != (op.After == nil) || current != nil && !sameRRSet(*current, *op.After) {
+			return nil, fmt.Errorf("%s: %w: %s %s changed after apply %d", ProviderName, ErrJournalConflict, op.Name, op.Type, id)
+		}
+		ops = append(ops, op.inverse())
+	}
+	ops, err := p.guardOperations(ops, zoneSizes(p.managedZones(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: undo %d: %w", ProviderName, id, err)
+	}
+	if dryRun {
+		p.auditOperations(ctx, "undo", ops, true)
+		return ops, nil
+	}
+	for i, op := range ops {
+		err = p.applyRRSetOperation(ctx, op)
+		p.auditOperation(ctx, "undo", op, false, err)
+		if err != nil {
+			return ops[:i], fmt.Errorf("%s: undo %d: %s %s %s: %w", ProviderName, id, op.Operation, op.Name, op.Type, err)
+		}
+		log.Infof("%s: undo %d: %s %s %s", ProviderName, id, op.Operation, op.Name, op.Type)
+	}
+	p.journal.markUndone(id, time.Now().UTC())
+	return ops, nil
+}
@@ -0,0 +1,173 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_dnsProvider_journalUndo(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryDNS("test.com")
+	_ = client.AddZoneRRSet(ctx, "test.com", "old.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+	}, 10)
+	_ = client.AddZoneRRSet(ctx, "test.com", "upd.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "2.2.2.2"),
+	}, 10)
+	file := filepath.Join(t.TempDir(), "journal.json")
+	j, err := newJournal(JournalConfig{File: file})
+	if err != nil {
+		t.Fatalf("newJournal() error = %v", err)
+	}
+	p := &DnsProvider{client: client, journal: j}
+
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 10, "3.3.3.3")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("old.test.com", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("upd.test.com", "A", "2.2.2.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("upd.test.com", "A", 10, "4.4.4.4")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	entries, err := p.Journal()
+	if err != nil || len(entries) != 1 || len(entries[0].Operations) != 3 {
+		t.Fatalf("Journal() = %+v, %v", entries, err)
+	}
+	id := entries[0].ID
+
+	// journal survives restarts
+	if restarted, err := newJournal(JournalConfig{File: file}); err != nil || len(restarted.list()) != 1 {
+		t.Fatalf("restarted journal = %+v, %v", restarted, err)
+	}
+
+	// records changed since the apply
+	_ = client.AddZoneRRSet(ctx, "test.com", "new.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "5.5.5.5"),
+	}, 10)
+	if _, err = p.Undo(ctx, id, false); !errors.Is(err, ErrJournalConflict) {
+		t.Fatalf("Undo() error = %v, want %v", err, ErrJournalConflict)
+	}
+	if _, err = client.RRSet(ctx, "test.com", "old.test.com", "A"); err == nil {
+		t.Fatalf("refused undo must not write")
+	}
+	_ = client.DeleteRRSetRecord(ctx, "test.com", "new.test.com", "A", "5.5.5.5")
+
+	ops, err := p.Undo(ctx, id, false)
+	if err != nil || len(ops) != 3 {
+		t.Fatalf("Undo() = %+v, %v", ops, err)
+	}
+	if _, err = client.RRSet(ctx, "test.com", "new.test.com", "A"); err == nil {
+		t.Errorf("new.test.com must be deleted")
+	}
+	for name, want := range map[string]string{"old.test.com": "1.1.1.1", "upd.test.com": "2.2.2.2"} {
+		rrSet, err := client.RRSet(ctx, "test.com", name, "A")
+		if err != nil || len(rrSet.Records) != 1 || rrSet.Records[0].ContentToString() != want {
+			t.Errorf("%s = %+v, %v, want %s", name, rrSet, err, want)
+		}
+	}
+	if _, err = p.Undo(ctx, id, false); !errors.Is(err, ErrJournalConflict) {
+		t.Errorf("second Undo() error = %v, want %v", err, ErrJournalConflict)
+	}
+	if _, err = p.Undo(ctx, id+1, false); !errors.Is(err, ErrJournalEntryNotFound) {
+		t.Errorf("Undo() error = %v, want %v", err, ErrJournalEntryNotFound)
+	}
+}
+
+func Test_dnsProvider_undoGuarded(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-1")
+	client := newMemoryDNS("test.com")
+	_ = client.AddZoneRRSet(ctx, "test.com", "upd.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "2.2.2.2"),
+	}, 10)
+	j, err := newJournal(JournalConfig{})
+	if err != nil {
+		t.Fatalf("newJournal() error = %v", err)
+	}
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	p := &DnsProvider{client: client, journal: j}
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 10, "3.3.3.3")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("upd.test.com", "A", "2.2.2.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("upd.test.com", "A", 10, "4.4.4.4")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	id := j.list()[0].ID
+	p.audit, _ = newAuditLog(AuditConfig{Path: auditPath})
+	defer p.audit.Close()
+
+	// deleting new.test.com and replacing 4.4.4.4 removes two records
+	WithDeletionLimits(DeletionLimits{MaxDeletes: 1})(p)
+	if _, err = p.Undo(ctx, id, false); !errors.Is(err, ErrDeletionLimit) {
+		t.Fatalf("Undo() error = %v, want deletion limit", err)
+	}
+	WithDeletionLimits(DeletionLimits{})(p)
+	protection, _ := NewProtectionRules([]string{"new.test.com"})
+	protection.Refuse = true
+	WithProtectionRules(protection)(p)
+	if _, err = p.Undo(ctx, id, true); !errors.Is(err, ErrProtectedRecord) {
+		t.Fatalf("Undo() error = %v, want protected record", err)
+	}
+
+	protection.Refuse = false
+	WithProtectionRules(protection)(p)
+	ops, err := p.Undo(ctx, id, false)
+	if err != nil || len(ops) != 1 || ops[0].Name != "upd.test.com" {
+		t.Fatalf("Undo() = %+v, %v", ops, err)
+	}
+	if _, err = client.RRSet(ctx, "test.com", "new.test.com", "A"); err != nil {
+		t.Errorf("protected new.test.com deleted by undo: %v", err)
+	}
+	entries := readAudit(t, auditPath)
+	if len(entries) != 1 || entries[0].Action != "undo" || entries[0].RequestID != "req-1" ||
+		entries[0].OldTargets[0] != "4.4.4.4" || entries[0].NewTargets[0] != "2.2.2.2" {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func Test_journal_size(t *testing.T) {
+	j, _ := newJournal(JournalConfig{Size: 2})
+	for i := 0; i < 3; i++ {
+		j.add(JournalEntry{})
+	}
+	entries := j.list()
+	if len(entries) != 2 || entries[0].ID != 3 || entries[1].ID != 2 {
+		t.Errorf("list() = %+v", entries)
+	}
+}
+
+func Test_dnsProvider_undoReordered(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryDNS("test.com")
+	j, err := newJournal(JournalConfig{})
+	if err != nil {
+		t.Fatalf("newJournal() error = %v", err)
+	}
+	p := &DnsProvider{client: client, journal: j}
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 10, "1.1.1.1", "2.2.2.2")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+
+	// the API returns the same records in another order
+	key := memoryKey("test.com", "new.test.com", "A")
+	rrSet := client.rrSets[key]
+	rrSet.Records = []gdns.ResourceRecord{rrSet.Records[1], rrSet.Records[0]}
+	client.rrSets[key] = rrSet
+	if _, err = p.Undo(ctx, j.list()[0].ID, false); err != nil {
+		t.Fatalf("Undo() of reordered records error = %v", err)
+	}
+	if _, err = client.RRSet(ctx, "test.com", "new.test.com", "A"); err == nil {
+		t.Errorf("new.test.com must be deleted")
+	}
+}
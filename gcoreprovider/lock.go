@@ -0,0 +1,139 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrApplyQueueFull returned when too many ApplyChanges wait for the same zone
+var ErrApplyQueueFull = errors.New("apply queue is full")
+
+// ZoneQueue shows how busy a zone is: running is 1 when an apply holds the zone
+type ZoneQueue struct {
+	Running int `json:"running"`
+	Waiting int `json:"waiting"`
+}
+
+// zoneLocker serializes ApplyChanges per zone, so overlapping applies from
+// retries or several external-dns replicas never touch the same RRSets concurrently.
+type zoneLocker struct {
+	mu       sync.Mutex
+	zones    map[string]*zoneLock
+	maxQueue int
+}
+
+type zoneLock struct {
+	sem     chan struct{}
+	waiting int
+}
+
+func newZoneLocker(maxQueue int) *zoneLocker {
+	return &zoneLocker{zones: map[string]*zoneLock{}, maxQueue: maxQueue}
+}
+
+// lock acquires all zones in a stable order to avoid deadlocks between applies
+// sharing several zones, the returned func releases them.
+// With maxQueue applies already waiting for a zone it fails fast with ErrApplyQueueFull.
+func (l *zoneLocker) lock(ctx context.Context, zones []string) (func(), error) {
+	zones = uniqueSorted(zones)
+	acquired := make([]string, 0, len(zones))
+	unlock := func() {
+		for _, z := range acquired {
+			l.release(z)
+		}
+	}
+	for _, z := range zones {
+		if err := l.acquire(ctx, z); err != nil {
+			unlock()
+			return nil, fmt.Errorf("lock zone %s: %w", z, err)
+		}
+		acquired = append(acquired, z)
+	}
+	return unlock, nil
+}
+
+func (l *zoneLocker) acquire(ctx context.Context, zone string) error {
+	l.mu.Lock()
+	zl, ok := l.zones[zone]
+	if !ok {
+		zl = &zoneLock{sem: make(chan struct{}, 1)}
+		l.zones[zone] = zl
+	}
+	select {
+	case zl.sem <- struct{}{}:
+		l.mu.Unlock()
+		return nil
+	default:
+	}
+	if zl.waiting >= l.maxQueue {
+		l.mu.Unlock()
+		return ErrApplyQueueFull
+	}
+	zl.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		zl.waiting--
+		// a waiter giving up after the holder released must not leave the zone behind
+		if zl.waiting == 0 && len(zl.sem) == 0 && l.zones[zone] == zl {
+			delete(l.zones, zone)
+		}
+	}()
+	select {
+	case zl.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *zoneLocker) release(zone string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	zl := l.zones[zone]
+	<-zl.sem
+	if zl.waiting == 0 && len(zl.sem) == 0 {
+		delete(l.zones, zone)
+	}
+}
+
+func (l *zoneLocker) queueLength() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxQueue
+}
+
+// setQueueLength applies to applies starting to wait afterwards, waiting ones are kept
+func (l *zoneLocker) setQueueLength(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxQueue = n
+}
+
+func (l *zoneLocker) depth() map[string]ZoneQueue {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make(map[string]ZoneQueue, len(l.zones))
+	for z, zl := range l.zones {
+		res[z] = ZoneQueue{Running: len(zl.sem), Waiting: zl.waiting}
+	}
+	return res
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+		res = append(res, v)
+	}
+	sort.Strings(res)
+	return res
+}
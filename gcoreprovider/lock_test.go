@@ -0,0 +1,96 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_zoneLocker(t *testing.T) {
+	l := newZoneLocker(1)
+	unlock, err := l.lock(context.Background(), []string{"b.com", "a.com", "a.com", ""})
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+	want := map[string]ZoneQueue{"a.com": {Running: 1}, "b.com": {Running: 1}}
+	if got := l.depth(); !reflect.DeepEqual(got, want) {
+		t.Errorf("depth() = %v, want %v", got, want)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		unlockWaiter, err := l.lock(context.Background(), []string{"a.com"})
+		if err == nil {
+			unlockWaiter()
+		}
+		acquired <- err
+	}()
+	for deadline := time.Now().Add(time.Second); l.depth()["a.com"].Waiting != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("waiter not queued: %v", l.depth())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// queue of length 1 is full now
+	if _, err = l.lock(context.Background(), []string{"a.com"}); !errors.Is(err, ErrApplyQueueFull) {
+		t.Errorf("lock() error = %v, want %v", err, ErrApplyQueueFull)
+	}
+	// failed lock must not leave b.com locked
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = l.lock(ctx, []string{"b.com"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lock() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	unlock()
+	if err = <-acquired; err != nil {
+		t.Errorf("queued lock() error = %v", err)
+	}
+	if got := l.depth(); len(got) != 0 {
+		t.Errorf("depth() = %v, want empty", got)
+	}
+}
+
+func Test_zoneLocker_failFast(t *testing.T) {
+	l := newZoneLocker(0)
+	unlock, err := l.lock(context.Background(), []string{"a.com"})
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+	defer unlock()
+	if _, err = l.lock(context.Background(), []string{"b.com", "a.com"}); !errors.Is(err, ErrApplyQueueFull) {
+		t.Errorf("lock() error = %v, want %v", err, ErrApplyQueueFull)
+	}
+	if got := l.depth(); !reflect.DeepEqual(got, map[string]ZoneQueue{"a.com": {Running: 1}}) {
+		t.Errorf("depth() = %v", got)
+	}
+}
+
+func Test_zoneLocker_cancelledWaiter(t *testing.T) {
+	l := newZoneLocker(1)
+	for i := 0; i < 100; i++ {
+		unlock, err := l.lock(context.Background(), []string{"a.com"})
+		if err != nil {
+			t.Fatalf("lock() error = %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if unlockWaiter, err := l.lock(ctx, []string{"a.com"}); err == nil {
+				unlockWaiter()
+			}
+		}()
+		for l.depth()["a.com"].Waiting != 1 {
+			time.Sleep(time.Microsecond)
+		}
+		cancel()
+		unlock()
+		<-done
+		if got := l.depth(); len(got) != 0 {
+			t.Fatalf("depth() after a cancelled waiter = %v, want empty", got)
+		}
+	}
+}
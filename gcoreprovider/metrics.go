@@ -0,0 +1,192 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "gcore_webhook"
+
+// Metrics are Prometheus collectors of the webhook, a nil *Metrics records nothing
+type Metrics struct {
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	apiCalls        *prometheus.CounterVec
+	apiDuration     *prometheus.HistogramVec
+	apiErrors       *prometheus.CounterVec
+	zoneRecords     *prometheus.GaugeVec
+	changesApplied  *prometheus.CounterVec
+	dryRun          prometheus.Gauge
+	lastSuccess     *prometheus.GaugeVec
+	tokenReloads    *prometheus.CounterVec
+	tokenFileOK     prometheus.Gauge
+}
+
+// NewMetrics creates the collectors and registers them in reg
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "http_requests_total",
+			Help: "Webhook requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "http_request_duration_seconds",
+			Help:    "Webhook request latency by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		apiCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "api_calls_total",
+			Help: "Gcore API calls by operation.",
+		}, []string{"operation"}),
+		apiDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace, Name: "api_call_duration_seconds",
+			Help:    "Gcore API call latency by operation.",
+			Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"operation"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "api_errors_total",
+			Help: "Failed Gcore API calls by operation and error class.",
+		}, []string{"operation", "class"}),
+		zoneRecords: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "zone_records",
+			Help: "Records per zone and type seen by the last successful Records.",
+		}, []string{"zone", "type"}),
+		changesApplied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "changes_applied_total",
+			Help: "Endpoint changes applied by kind.",
+		}, []string{"kind"}),
+		dryRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "dry_run",
+			Help: "1 when the provider runs in dry-run mode.",
+		}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "last_success_timestamp_seconds",
+			Help: "Unix time of the last successful Records or ApplyChanges.",
+		}, []string{"operation"}),
+		tokenReloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: "token_reloads_total",
+			Help: "Token reloads by result: success for a new token, failure when the file or command failed.",
+		}, []string{"result"}),
+		tokenFileOK: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace, Name: "token_file_ok",
+			Help: "1 when the last check of the token file or command succeeded, 0 when the previous token is still used.",
+		}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.requestDuration, m.apiCalls, m.apiDuration,
+		m.apiErrors, m.zoneRecords, m.changesApplied, m.dryRun, m.lastSuccess, m.tokenReloads, m.tokenFileOK} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveRequest records a webhook request served on route
+func (m *Metrics) ObserveRequest(route, method string, code int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(duration.Seconds())
+}
+
+func (m *Metrics) observeAPICall(operation string, started time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.apiCalls.WithLabelValues(operation).Inc()
+	m.apiDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+	if err != nil {
+		m.apiErrors.WithLabelValues(operation, errorClass(err)).Inc()
+	}
+}
+
+func (m *Metrics) setZoneRecords(zs []gdns.Zone) {
+	if m == nil {
+		return
+	}
+	m.zoneRecords.Reset()
+	for _, z := range zs {
+		zone := strings.Trim(z.Name, ".")
+		for _, r := range z.Records {
+			m.zoneRecords.WithLabelValues(zone, r.Type).Add(float64(len(r.ShortAnswers)))
+		}
+	}
+}
+
+func (m *Metrics) addChanges(kind string, n int) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.changesApplied.WithLabelValues(kind).Add(float64(n))
+}
+
+func (m *Metrics) setDryRun(dryRun bool) {
+	if m == nil {
+		return
+	}
+	if dryRun {
+		m.dryRun.Set(1)
+	} else {
+		m.dryRun.Set(0)
+	}
+}
+
+func (m *Metrics) success(operation string) {
+	if m == nil {
+		return
+	}
+	m.lastSuccess.WithLabelValues(operation).SetToCurrentTime()
+}
+
+// tokenChecked records a check of the token file or command, changed tells if a new token was read
+func (m *Metrics) tokenChecked(err error, changed bool) {
+	if m == nil {
+		return
+	}
+	switch {
+	case err != nil:
+		m.tokenReloads.WithLabelValues("failure").Inc()
+		m.tokenFileOK.Set(0)
+	case changed:
+		m.tokenReloads.WithLabelValues("success").Inc()
+		m.tokenFileOK.Set(1)
+	default:
+		m.tokenFileOK.Set(1)
+	}
+}
+
+// errorClass groups API errors into a small set of label values
+func errorClass(err error) string {
+	apiErr := new(gdns.APIError)
+	netErr := net.Error(nil)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+			return "auth"
+		case apiErr.StatusCode == http.StatusNotFound:
+			return "not_found"
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return "rate_limited"
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return "server"
+		}
+		return "client"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
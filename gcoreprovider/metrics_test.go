@@ -0,0 +1,78 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_dnsProvider_metrics(t *testing.T) {
+	ctx := context.Background()
+	m, err := NewMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("NewMetrics() error = %v", err)
+	}
+	mem := newMemoryDNS("test.com")
+	p := &DnsProvider{client: &instrumentedClient{dnsManager: mem, metrics: m}, metrics: m}
+
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a.test.com", "A", 10, "1.1.1.1", "1.1.1.2"),
+			endpoint.NewEndpointWithTTL("b.test.com", "CNAME", 10, "a.test.com"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	if _, err = p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if got := testutil.ToFloat64(m.changesApplied.WithLabelValues("create")); got != 2 {
+		t.Errorf("changes applied create = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.zoneRecords.WithLabelValues("test.com", "A")); got != 2 {
+		t.Errorf("zone records A = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.apiCalls.WithLabelValues("add_zone_rrset")); got != 2 {
+		t.Errorf("api calls add_zone_rrset = %v, want 2", got)
+	}
+	for _, op := range []string{"records", "apply_changes"} {
+		if got := testutil.ToFloat64(m.lastSuccess.WithLabelValues(op)); got == 0 {
+			t.Errorf("last success %s is not set", op)
+		}
+	}
+	if _, err = p.client.RRSet(ctx, "test.com", "c.test.com", "A"); err == nil {
+		t.Fatalf("RRSet() of a missing record must fail")
+	}
+	if got := testutil.ToFloat64(m.apiErrors.WithLabelValues("rrset", "not_found")); got != 1 {
+		t.Errorf("api errors rrset not_found = %v, want 1", got)
+	}
+}
+
+func Test_errorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{gdns.APIError{StatusCode: http.StatusUnauthorized}, "auth"},
+		{fmt.Errorf("all zones: %w", gdns.APIError{StatusCode: http.StatusTooManyRequests}), "rate_limited"},
+		{gdns.APIError{StatusCode: http.StatusBadGateway}, "server"},
+		{gdns.APIError{StatusCode: http.StatusBadRequest}, "client"},
+		{errors.New("boom"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gcoreprovider
+
+import "time"
+
+// Option customizes DnsProvider created by NewProvider
+type Option func(*DnsProvider)
+
+// WithTimeouts sets the upper bound for listing zones/records and for a single
+// ApplyChanges call, zero or negative keeps the default.
+func WithTimeouts(list, apply time.Duration) Option {
+	return func(p *DnsProvider) {
+		if list > 0 {
+			p.listTimeout = list
+		}
+		if apply > 0 {
+			p.applyTimeout = apply
+		}
+	}
+}
+
+// WithApplyQueueLength limits how many ApplyChanges may wait for a zone
+// that is being changed by another apply, 0 makes overlapping applies fail fast.
+func WithApplyQueueLength(n int) Option {
+	return func(p *DnsProvider) {
+		if n >= 0 {
+			p.locker = newZoneLocker(n)
+		}
+	}
+}
+
+// WithDeletionLimits aborts ApplyChanges deleting more records than allowed
+func WithDeletionLimits(limits DeletionLimits) Option {
+	return func(p *DnsProvider) {
+		p.deletionLimits = limits
+	}
+}
+
+// WithProtectionRules keeps hand-managed records away from external-dns
+func WithProtectionRules(rules ProtectionRules) Option {
+	return func(p *DnsProvider) {
+		p.protection = rules
+	}
+}
+
+// WithSoftDelete makes ApplyChanges disable deleted records and purge them after grace,
+// stateFile keeps track of disabled records between restarts and may be empty.
+func WithSoftDelete(grace time.Duration, stateFile string) Option {
+	return func(p *DnsProvider) {
+		p.softDeleteGrace = grace
+		p.softDeleteFile = stateFile
+	}
+}
+
+// WithAuditLog writes every change applied by ApplyChanges to an append-only JSON-lines log
+func WithAuditLog(cfg AuditConfig) Option {
+	return func(p *DnsProvider) {
+		p.auditConfig = cfg
+	}
+}
+
+// WithDryRunPlanFile writes the plan of every ApplyChanges in dry-run mode to file
+func WithDryRunPlanFile(file string) Option {
+	return func(p *DnsProvider) {
+		p.dryRunPlans.file = file
+	}
+}
+
+// WithSnapshots stores zone snapshots in cfg.Dir, optionally before every apply deleting records
+func WithSnapshots(cfg SnapshotConfig) Option {
+	return func(p *DnsProvider) {
+		if cfg.Dir != "" {
+			p.snapshots = &snapshotStore{cfg: cfg}
+		}
+	}
+}
+
+// WithJournal records every ApplyChanges with the RRSets it changed so it can be undone
+func WithJournal(cfg JournalConfig) Option {
+	return func(p *DnsProvider) {
+		p.journalConfig = &cfg
+	}
+}
+
+// WithMetrics records provider and Gcore API metrics in m
+func WithMetrics(m *Metrics) Option {
+	return func(p *DnsProvider) {
+		p.metrics = m
+	}
+}
+
+// WithReadiness tunes the API check cache and the allowed age of the last successful Records
+func WithReadiness(cfg ReadinessConfig) Option {
+	return func(p *DnsProvider) {
+		p.readinessConfig = cfg
+	}
+}
+
+// WithAPIDebug switches the request logging of the Gcore SDK, it goes to the standard log package
+func WithAPIDebug(debug bool) Option {
+	return func(p *DnsProvider) {
+		p.apiDebug = debug
+	}
+}
+
+// WithTokenFile reads the API token from a file and switches to a new token when the file changes
+func WithTokenFile(cfg TokenFileConfig) Option {
+	return func(p *DnsProvider) {
+		p.tokenFile = cfg
+	}
+}
+
+// WithRedactor registers tokens read at runtime in r
+func WithRedactor(r *Redactor) Option {
+	return func(p *DnsProvider) {
+		p.redactor = r
+	}
+}
+
+// WithAuth selects the Authorization scheme and a command fetching fresh tokens
+func WithAuth(cfg AuthConfig) Option {
+	return func(p *DnsProvider) {
+		p.auth = cfg
+	}
+}
+
+// WithHTTPClient sets the proxy, trusted CAs, timeouts and user agent of Gcore API requests
+func WithHTTPClient(cfg HTTPClientConfig) Option {
+	return func(p *DnsProvider) {
+		p.httpClient = cfg
+	}
+}
+
+// WithAccounts routes every zone to the Gcore account owning it, the token passed
+// to NewProvider becomes the account DefaultAccount when set
+func WithAccounts(accounts ...AccountConfig) Option {
+	return func(p *DnsProvider) {
+		p.accounts = accounts
+	}
+}
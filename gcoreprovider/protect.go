@@ -0,0 +1,137 @@
+package gcoreprovider
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// ErrProtectedRecord returned when changes touch a protected record in refuse mode
+var ErrProtectedRecord = errors.New("protected record")
+
+// ProtectionRules describe hand-managed records the webhook never modifies or deletes
+type ProtectionRules struct {
+	rules []protectionRule
+	// Refuse fails the whole apply instead of skipping changes to protected records
+	Refuse bool
+	// Hide removes protected records from Records, so external-dns never plans against them
+	Hide bool
+}
+
+type protectionRule struct {
+	name       string
+	recordType string
+}
+
+// NewProtectionRules parses rules in the form <name>[/<type>], where name is
+// a DNS name or a glob like "_acme-challenge.*" and type is a record type like MX.
+// "*/MX" protects all MX records, "example.com/TXT" the apex TXT records.
+func NewProtectionRules(rules []string) (ProtectionRules, error) {
+	res := ProtectionRules{}
+	for _, raw := range rules {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		name, recordType, _ := strings.Cut(raw, "/")
+		rule := protectionRule{
+			name:       normalizeName(name),
+			recordType: strings.ToUpper(strings.TrimSpace(recordType)),
+		}
+		if rule.name == "" {
+			rule.name = "*"
+		}
+		if _, err := path.Match(rule.name, ""); err != nil {
+			return ProtectionRules{}, fmt.Errorf("protected record %q: %w", raw, err)
+		}
+		res.rules = append(res.rules, rule)
+	}
+	return res, nil
+}
+
+// Empty is true when no record is protected
+func (pr ProtectionRules) Empty() bool {
+	return len(pr.rules) == 0
+}
+
+func (pr ProtectionRules) String() string {
+	rules := make([]string, len(pr.rules))
+	for i, r := range pr.rules {
+		rules[i] = r.name
+		if r.recordType != "" {
+			rules[i] += "/" + r.recordType
+		}
+	}
+	return fmt.Sprintf("rules=%v refuse=%v hide=%v", rules, pr.Refuse, pr.Hide)
+}
+
+func (pr ProtectionRules) protects(dnsName, recordType string) bool {
+	dnsName, recordType = normalizeName(dnsName), strings.ToUpper(recordType)
+	for _, r := range pr.rules {
+		if r.recordType != "" && r.recordType != recordType {
+			continue
+		}
+		if ok, _ := path.Match(r.name, dnsName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// filterRecords drops protected records when they are configured to be hidden
+func (pr ProtectionRules) filterRecords(eps []*endpoint.Endpoint) []*endpoint.Endpoint {
+	if !pr.Hide || pr.Empty() {
+		return eps
+	}
+	res := make([]*endpoint.Endpoint, 0, len(eps))
+	for _, e := range eps {
+		if pr.protects(e.DNSName, e.RecordType) {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// filterChanges returns changes without the ones touching protected records,
+// or ErrProtectedRecord in refuse mode.
+func (pr ProtectionRules) filterChanges(changes *plan.Changes) (*plan.Changes, error) {
+	if pr.Empty() {
+		return changes, nil
+	}
+	var refused []string
+	filter := func(kind string, eps []*endpoint.Endpoint) []*endpoint.Endpoint {
+		res := make([]*endpoint.Endpoint, 0, len(eps))
+		for _, e := range eps {
+			if !pr.protects(e.DNSName, e.RecordType) {
+				res = append(res, e)
+				continue
+			}
+			msg := fmt.Sprintf("%s %s %s %v", kind, e.DNSName, e.RecordType, e.Targets)
+			refused = append(refused, msg)
+			if !pr.Refuse {
+				log.Warnf("%s: skipping change of protected record: %s", ProviderName, msg)
+			}
+		}
+		return res
+	}
+	res := &plan.Changes{
+		Create:    filter("create", changes.Create),
+		UpdateOld: filter("update old", changes.UpdateOld),
+		UpdateNew: filter("update new", changes.UpdateNew),
+		Delete:    filter("delete", changes.Delete),
+	}
+	if pr.Refuse && len(refused) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrProtectedRecord, strings.Join(refused, "; "))
+	}
+	return res, nil
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(name), "."))
+}
@@ -0,0 +1,87 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestProtectionRules_protects(t *testing.T) {
+	pr, err := NewProtectionRules([]string{"*/MX", " example.com/txt", "_acme-challenge.*", "static.example.com."})
+	if err != nil {
+		t.Fatalf("NewProtectionRules() error = %v", err)
+	}
+	tests := []struct {
+		dnsName    string
+		recordType string
+		want       bool
+	}{
+		{"example.com", "MX", true},
+		{"mail.example.com", "MX", true},
+		{"example.com", "TXT", true},
+		{"example.com.", "TXT", true},
+		{"example.com", "A", false},
+		{"www.example.com", "TXT", false},
+		{"_acme-challenge.www.example.com", "TXT", true},
+		{"Static.Example.com", "CNAME", true},
+		{"app.example.com", "A", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dnsName+"/"+tt.recordType, func(t *testing.T) {
+			if got := pr.protects(tt.dnsName, tt.recordType); got != tt.want {
+				t.Errorf("protects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err = NewProtectionRules([]string{"[a-"}); err == nil {
+		t.Errorf("NewProtectionRules() expected error for malformed pattern")
+	}
+}
+
+func TestProtectionRules_filterChanges(t *testing.T) {
+	pr, _ := NewProtectionRules([]string{"*/MX"})
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("a.test.com", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("test.com", "MX", "10 mx1.test.com")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("test.com", "MX", "10 mx2.test.com")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("test.com", "MX", "20 mx3.test.com")},
+	}
+	got, err := pr.filterChanges(changes)
+	if err != nil {
+		t.Fatalf("filterChanges() error = %v", err)
+	}
+	if len(got.Create) != 1 || len(got.UpdateOld)+len(got.UpdateNew)+len(got.Delete) != 0 {
+		t.Errorf("filterChanges() = %+v", got)
+	}
+	pr.Refuse = true
+	if _, err = pr.filterChanges(changes); !errors.Is(err, ErrProtectedRecord) {
+		t.Errorf("filterChanges() error = %v, want %v", err, ErrProtectedRecord)
+	}
+}
+
+func Test_dnsProvider_Records_hideProtected(t *testing.T) {
+	pr, _ := NewProtectionRules([]string{"*/MX"})
+	pr.Hide = true
+	p := &DnsProvider{
+		client: dnsManagerMock{
+			zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+				return []gdns.Zone{{Name: "test.com", Records: []gdns.ZoneRecord{
+					{Name: "test.com", Type: "MX", ShortAnswers: []string{"10 mx.test.com"}},
+					{Name: "a.test.com", Type: "A", ShortAnswers: []string{"1.1.1.1"}},
+				}}}, nil
+			},
+		},
+		protection: pr,
+	}
+	got, err := p.Records(context.Background())
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(got) != 1 || got[0].DNSName != "a.test.com" {
+		t.Errorf("Records() = %v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package gcoreprovider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultReadinessCacheTTL      = 30 * time.Second
+	defaultReadinessMaxRecordsAge = 10 * time.Minute
+	readinessCheckTimeout         = 10 * time.Second
+)
+
+// ReadinessConfig tunes Readiness
+type ReadinessConfig struct {
+	// CacheTTL is how long the result of the API check is reused
+	CacheTTL time.Duration
+	// MaxRecordsAge is the longest time without a successful Records,
+	// zero keeps the default and negative disables the check.
+	MaxRecordsAge time.Duration
+}
+
+// ReadinessReport describes why the provider is ready or not
+type ReadinessReport struct {
+	Ready bool      `json:"ready"`
+	API   APICheck  `json:"api"`
+	Sync  SyncCheck `json:"sync"`
+	// Degraded is set when the startup self-test found problems or the token source fails
+	Degraded bool            `json:"degraded"`
+	SelfTest *SelfTestReport `json:"selfTest,omitempty"`
+	Token    *TokenCheck     `json:"token,omitempty"`
+}
+
+// APICheck is the cached result of an authenticated Gcore API call
+type APICheck struct {
+	OK        bool          `json:"ok"`
+	CheckedAt time.Time     `json:"checkedAt"`
+	Latency   time.Duration `json:"latencyNs"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// SyncCheck tells how long ago Records succeeded
+type SyncCheck struct {
+	OK            bool          `json:"ok"`
+	LastRecords   *time.Time    `json:"lastRecords,omitempty"`
+	Age           time.Duration `json:"ageNs"`
+	MaxRecordsAge time.Duration `json:"maxRecordsAgeNs"`
+}
+
+type readiness struct {
+	cfg         ReadinessConfig
+	startedAt   time.Time
+	mu          sync.Mutex
+	api         APICheck
+	lastRecords time.Time
+	selfTest    *SelfTestReport
+	now         func() time.Time
+	// checks runs a single API check for concurrent probes, mu isn't held while it runs
+	checks singleflight.Group
+}
+
+func newReadiness(cfg ReadinessConfig) *readiness {
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultReadinessCacheTTL
+	}
+	switch {
+	case cfg.MaxRecordsAge == 0:
+		cfg.MaxRecordsAge = defaultReadinessMaxRecordsAge
+	case cfg.MaxRecordsAge < 0:
+		cfg.MaxRecordsAge = 0
+	}
+	return &readiness{cfg: cfg, startedAt: time.Now(), now: time.Now}
+}
+
+func (r *readiness) recordsSucceeded() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.lastRecords = r.now()
+	r.mu.Unlock()
+}
+
+// Readiness checks the Gcore API with the token, reusing a recent result,
+// and how long ago external-dns got records successfully.
+func (p *DnsProvider) Readiness(ctx context.Context) ReadinessReport {
+	r := p.readiness
+	if r == nil {
+		r = newReadiness(ReadinessConfig{})
+	}
+	r.mu.Lock()
+	stale := r.api.CheckedAt.IsZero() || r.now().Sub(r.api.CheckedAt) >= r.cfg.CacheTTL
+	r.mu.Unlock()
+	if stale {
+		// the check outlives a probe which gives up, the next probe gets its result
+		done := r.checks.DoChan("api", func() (interface{}, error) {
+			api := p.checkAPI(context.WithoutCancel(ctx), r.now)
+			r.mu.Lock()
+			r.api = api
+			r.mu.Unlock()
+			return api, nil
+		})
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	since := r.startedAt
+	sync := SyncCheck{OK: true, MaxRecordsAge: r.cfg.MaxRecordsAge}
+	if !r.lastRecords.IsZero() {
+		last := r.lastRecords
+		sync.LastRecords = &last
+		since = last
+	}
+	sync.Age = now.Sub(since)
+	if r.cfg.MaxRecordsAge > 0 && sync.Age > r.cfg.MaxRecordsAge {
+		sync.OK = false
+	}
+	report := ReadinessReport{Ready: r.api.OK && sync.OK, API: r.api, Sync: sync, SelfTest: r.selfTest}
+	report.Token = p.tokenCheck()
+	report.Degraded = r.selfTest != nil && !r.selfTest.OK || report.Token != nil && !report.Token.OK
+	return report
+}
+
+// checkAPI lists a single zone, enough to prove reachability and a valid token
+func (p *DnsProvider) checkAPI(rootCtx context.Context, now func() time.Time) APICheck {
+	ctx, cancel := context.WithTimeout(rootCtx, readinessCheckTimeout)
+	defer cancel()
+	started := time.Now()
+	_, err := p.client.ZonesWithParam(ctx, gdns.ZonesParam{Limit: 1})
+	res := APICheck{OK: err == nil, CheckedAt: now(), Latency: time.Since(started)}
+	if err != nil {
+		res.Error = fmt.Sprintf("%s: %v", errorClass(err), err)
+	}
+	return res
+}
@@ -0,0 +1,112 @@
+package gcoreprovider
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+)
+
+func Test_dnsProvider_Readiness(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	var apiErr error
+	client := dnsManagerMock{
+		zonesWithParam: func(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+			calls++
+			return gdns.ListZones{}, apiErr
+		},
+		zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+			return nil, nil
+		},
+	}
+	now := time.Now()
+	r := newReadiness(ReadinessConfig{CacheTTL: time.Minute, MaxRecordsAge: 5 * time.Minute})
+	r.now = func() time.Time { return now }
+	r.startedAt = now
+	p := &DnsProvider{client: client, readiness: r}
+
+	if report := p.Readiness(ctx); !report.Ready || !report.API.OK || !report.Sync.OK {
+		t.Fatalf("Readiness() = %+v, want ready", report)
+	}
+
+	// the API check is cached
+	apiErr = gdns.APIError{StatusCode: http.StatusUnauthorized, Message: "token revoked"}
+	now = now.Add(30 * time.Second)
+	if report := p.Readiness(ctx); !report.Ready || calls != 1 {
+		t.Fatalf("Readiness() = %+v, calls=%d, want cached ready", report, calls)
+	}
+	now = now.Add(time.Minute)
+	report := p.Readiness(ctx)
+	if report.Ready || report.API.OK || report.API.Error == "" || calls != 2 {
+		t.Fatalf("Readiness() = %+v, calls=%d, want API failure", report, calls)
+	}
+
+	// records freshness
+	apiErr = nil
+	now = now.Add(5 * time.Minute)
+	if report = p.Readiness(ctx); report.Ready || report.Sync.OK {
+		t.Fatalf("Readiness() = %+v, want stale records", report)
+	}
+	if _, err := p.Records(ctx); err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if report = p.Readiness(ctx); !report.Ready || report.Sync.LastRecords == nil || report.Sync.Age != 0 {
+		t.Errorf("Readiness() = %+v, want ready after Records", report)
+	}
+}
+
+func Test_dnsProvider_Readiness_slowAPI(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	client := dnsManagerMock{
+		zonesWithParam: func(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+			if calls.Add(1) == 1 {
+				close(entered)
+			}
+			<-release
+			return gdns.ListZones{}, nil
+		},
+		zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+			return nil, nil
+		},
+	}
+	p := &DnsProvider{client: client, readiness: newReadiness(ReadinessConfig{})}
+	reports := make(chan ReadinessReport, 2)
+	for i := 0; i < 2; i++ {
+		go func() { reports <- p.Readiness(context.Background()) }()
+	}
+	<-entered
+
+	records := make(chan error, 1)
+	go func() {
+		_, err := p.Records(context.Background())
+		records <- err
+	}()
+	select {
+	case err := <-records:
+		if err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Records() blocked by a running API check")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := p.Readiness(ctx); report.Ready {
+		t.Errorf("Readiness() of a cancelled probe = %+v, want not ready before the check finished", report)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if report := <-reports; !report.Ready {
+			t.Errorf("Readiness() = %+v, want ready", report)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("API checks of concurrent probes = %d, want 1", n)
+	}
+}
@@ -0,0 +1,67 @@
+package gcoreprovider
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authorizationPattern matches Authorization header values as printed by
+// http.Header, JSON or key=value logs, e.g. `Authorization: APIKey 123`.
+var authorizationPattern = regexp.MustCompile(`(?i)(authorization"?\s*[:=]\s*\[?"?)((?:apikey|bearer|basic)\s+)?[^\s"\],]+`)
+
+// Redactor hides credentials in text
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// NewRedactor redacts the given secrets and any Authorization header value
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(secrets...)
+	return r
+}
+
+// Add registers more secrets, e.g. a rotated token, known ones are skipped
+func (r *Redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range secrets {
+		if s = strings.TrimSpace(s); s != "" && !contains(r.secrets, s) {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+}
+
+// Redact replaces secrets and Authorization header values in s
+func (r *Redactor) Redact(s string) string {
+	s = authorizationPattern.ReplaceAllString(s, "${1}${2}"+redacted)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// redactingFormatter redacts every formatted log entry, whatever logged it
+type redactingFormatter struct {
+	log.Formatter
+	redactor *Redactor
+}
+
+// NewRedactingFormatter wraps next so no log line can carry a credential
+func NewRedactingFormatter(next log.Formatter, r *Redactor) log.Formatter {
+	return &redactingFormatter{Formatter: next, redactor: r}
+}
+
+func (f *redactingFormatter) Format(e *log.Entry) ([]byte, error) {
+	bs, err := f.Formatter.Format(e)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(f.redactor.Redact(string(bs))), nil
+}
@@ -0,0 +1,47 @@
+package gcoreprovider
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	r := NewRedactor("s3cr3t-token")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Authorization: APIKey 123abc", "Authorization: APIKey ***"},
+		{`{"Authorization":"Bearer eyJhbGciOi.x.y"}`, `{"Authorization":"Bearer ***"}`},
+		{"map[Authorization:[APIKey 42]]", "map[Authorization:[APIKey ***]]"},
+		{"authorization=abc def", "authorization=*** def"},
+		{"request failed for token s3cr3t-token", "request failed for token ***"},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	r.Add("rotated", "rotated", "s3cr3t-token")
+	if n := len(r.secrets); n != 2 {
+		t.Errorf("secrets after adding known ones = %d, want 2", n)
+	}
+	if got := r.Redact("new rotated value"); got != "new *** value" {
+		t.Errorf("Redact() = %q after Add", got)
+	}
+}
+
+func TestNewRedactingFormatter(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(out)
+	logger.SetFormatter(NewRedactingFormatter(&log.JSONFormatter{}, NewRedactor("s3cr3t-token")))
+	logger.WithField("header", "Authorization: APIKey s3cr3t-token").Info("token s3cr3t-token")
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("log line leaks the token: %s", out.String())
+	}
+}
@@ -0,0 +1,103 @@
+package gcoreprovider
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// ErrDeletionLimit returned when ApplyChanges would delete more than allowed
+var ErrDeletionLimit = errors.New("deletion limit exceeded")
+
+// DeletionLimits aborts the whole ApplyChanges before any API call
+// when a broken source makes external-dns delete too many records at once.
+type DeletionLimits struct {
+	// MaxDeletes is the max number of deleted records per apply, 0 is unlimited
+	MaxDeletes int
+	// MaxZoneShare is the max share (0..1] of a zone's records deleted per apply, 0 is unlimited
+	MaxZoneShare float64
+	// AllowMassDelete turns the limits off for intentional mass deletes
+	AllowMassDelete bool
+}
+
+func (l DeletionLimits) check(changes *plan.Changes,
+	extractZone func(name string) (zone string), zoneSize map[string]int) error {
+	if l.AllowMassDelete || (l.MaxDeletes <= 0 && l.MaxZoneShare <= 0) {
+		return nil
+	}
+	total := 0
+	perZone := map[string]int{}
+	count := func(name string, n int) {
+		if zone := extractZone(name); zone != "" && n > 0 {
+			total += n
+			perZone[zone] += n
+		}
+	}
+	for _, d := range changes.Delete {
+		count(d.DNSName, len(d.Targets))
+	}
+	for _, old := range changes.UpdateOld {
+		count(old.DNSName, removedTargets(old, changes.UpdateNew))
+	}
+	if l.MaxDeletes > 0 && total > l.MaxDeletes {
+		return fmt.Errorf("%w: max deletes per apply is %d, requested %d",
+			ErrDeletionLimit, l.MaxDeletes, total)
+	}
+	if l.MaxZoneShare <= 0 {
+		return nil
+	}
+	zones := make([]string, 0, len(perZone))
+	for zone := range perZone {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	for _, zone := range zones {
+		size := zoneSize[zone]
+		if size == 0 {
+			continue
+		}
+		if share := float64(perZone[zone]) / float64(size); share > l.MaxZoneShare {
+			return fmt.Errorf("%w: max zone share is %.2f, requested %d of %d records (%.2f) in zone %s",
+				ErrDeletionLimit, l.MaxZoneShare, perZone[zone], size, share, zone)
+		}
+	}
+	return nil
+}
+
+// removedTargets counts the targets of old missing from its counterpart in updateNew,
+// an update shrinking an RRSet deletes records as well
+func removedTargets(old *endpoint.Endpoint, updateNew []*endpoint.Endpoint) int {
+	for _, n := range updateNew {
+		if n.DNSName != old.DNSName || n.RecordType != old.RecordType || n.SetIdentifier != old.SetIdentifier {
+			continue
+		}
+		kept := make(map[string]bool, len(n.Targets))
+		for _, t := range n.Targets {
+			kept[t] = true
+		}
+		removed := 0
+		for _, t := range old.Targets {
+			if !kept[t] {
+				removed++
+			}
+		}
+		return removed
+	}
+	return len(old.Targets)
+}
+
+// zoneSizes counts record values per zone
+func zoneSizes(zs []gdns.Zone) map[string]int {
+	res := make(map[string]int, len(zs))
+	for _, z := range zs {
+		for _, r := range z.Records {
+			res[strings.Trim(z.Name, ".")] += len(r.ShortAnswers)
+		}
+	}
+	return res
+}
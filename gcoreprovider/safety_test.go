@@ -0,0 +1,91 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func TestDeletionLimits_check(t *testing.T) {
+	zs := []gdns.Zone{
+		{Name: "test.com", Records: []gdns.ZoneRecord{
+			{Name: "a.test.com", Type: "A", ShortAnswers: []string{"1.1.1.1", "1.1.1.2"}},
+			{Name: "b.test.com", Type: "A", ShortAnswers: []string{"1.1.1.3", "1.1.1.4"}},
+		}},
+	}
+	changes := &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("a.test.com", "A", "1.1.1.1", "1.1.1.2"),
+			endpoint.NewEndpoint("b.test.com", "A", "1.1.1.3"),
+			endpoint.NewEndpoint("unmanaged.org", "A", "1.1.1.1"),
+		},
+	}
+	tests := []struct {
+		name    string
+		limits  DeletionLimits
+		wantErr bool
+	}{
+		{name: "unlimited", limits: DeletionLimits{}},
+		{name: "max deletes ok", limits: DeletionLimits{MaxDeletes: 3}},
+		{name: "max deletes exceeded", limits: DeletionLimits{MaxDeletes: 2}, wantErr: true},
+		{name: "zone share ok", limits: DeletionLimits{MaxZoneShare: 0.75}},
+		{name: "zone share exceeded", limits: DeletionLimits{MaxZoneShare: 0.5}, wantErr: true},
+		{name: "override", limits: DeletionLimits{MaxDeletes: 1, MaxZoneShare: 0.1, AllowMassDelete: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.check(changes, zoneFromDNSNameGetter(zs), zoneSizes(zs))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrDeletionLimit) {
+				t.Errorf("check() error = %v, want %v", err, ErrDeletionLimit)
+			}
+		})
+	}
+}
+
+func TestDeletionLimits_checkUpdates(t *testing.T) {
+	zs := []gdns.Zone{{Name: "test.com", Records: []gdns.ZoneRecord{
+		{Name: "a.test.com", Type: "A", ShortAnswers: []string{"1.1.1.1", "1.1.1.2", "1.1.1.3"}},
+	}}}
+	shrink := &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("a.test.com", "A", "1.1.1.1", "1.1.1.2", "1.1.1.3")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("a.test.com", "A", "1.1.1.1", "1.1.1.4")},
+	}
+	limits := DeletionLimits{MaxDeletes: 1}
+	if err := limits.check(shrink, zoneFromDNSNameGetter(zs), zoneSizes(zs)); !errors.Is(err, ErrDeletionLimit) {
+		t.Errorf("check() of an update removing 2 targets error = %v, want %v", err, ErrDeletionLimit)
+	}
+	limits.MaxDeletes = 2
+	if err := limits.check(shrink, zoneFromDNSNameGetter(zs), zoneSizes(zs)); err != nil {
+		t.Errorf("check() error = %v", err)
+	}
+}
+
+func Test_dnsProvider_ApplyChanges_deletionLimit(t *testing.T) {
+	p := &DnsProvider{
+		client: dnsManagerMock{
+			zonesWithRecords: func(ctx context.Context, filters []string) ([]gdns.Zone, error) {
+				return []gdns.Zone{{Name: "test.com", Records: []gdns.ZoneRecord{
+					{Name: "my.test.com", Type: "A", ShortAnswers: []string{"1.1.1.1"}},
+				}}}, nil
+			},
+			deleteRRSetRecord: func(ctx context.Context, zone, name, recordType string, contents ...string) error {
+				t.Errorf("DeleteRRSetRecord() must not be called")
+				return nil
+			},
+		},
+		deletionLimits: DeletionLimits{MaxZoneShare: 0.5},
+	}
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("my.test.com", "A", "1.1.1.1")},
+	})
+	if !errors.Is(err, ErrDeletionLimit) {
+		t.Errorf("ApplyChanges() error = %v, want %v", err, ErrDeletionLimit)
+	}
+}
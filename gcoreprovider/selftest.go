@@ -0,0 +1,159 @@
+package gcoreprovider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SelfTestOff skips the startup self-test
+	SelfTestOff = "off"
+	// SelfTestWarn logs problems and reports the provider as degraded
+	SelfTestWarn = "warn"
+	// SelfTestStrict makes the startup fail on any problem
+	SelfTestStrict = "strict"
+
+	selfTestZonesPage  = 1000
+	selfTestProbeLabel = "_gcore-webhook-probe-"
+)
+
+// ErrSelfTest returned by CheckSelfTest in strict mode
+var ErrSelfTest = errors.New("self-test failed")
+
+// SelfTestReport is the result of the startup self-test
+type SelfTestReport struct {
+	OK        bool      `json:"ok"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Zones     int       `json:"zones"`
+	Problems  []string  `json:"problems,omitempty"`
+}
+
+// SelfTest lists zones, confirms that every domain filter entry belongs to one of them
+// and probes write permission by deleting an RRSet which does not exist.
+func (p *DnsProvider) SelfTest(rootCtx context.Context) SelfTestReport {
+	ctx, span := startSpan(rootCtx, "SelfTest")
+	defer span.End()
+	ctx, cancel := p.withListTimeout(ctx)
+	defer cancel()
+	report := SelfTestReport{CheckedAt: time.Now().UTC(), Problems: []string{}}
+	zones, err := p.zoneNames(ctx)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("list zones: %s: %v", errorClass(err), err))
+		return p.storeSelfTest(report)
+	}
+	report.Zones = len(zones)
+	if len(zones) == 0 {
+		report.Problems = append(report.Problems, "the token sees no zones")
+		return p.storeSelfTest(report)
+	}
+	probeZone := zones[0]
+	for _, f := range p.settings().domainFilter.Filters {
+		f = normalizeName(f)
+		if f == "" {
+			continue
+		}
+		zone := parentZone(zones, f)
+		if zone == "" {
+			report.Problems = append(report.Problems, fmt.Sprintf("domain filter %s: no such zone in the account", f))
+			continue
+		}
+		probeZone = zone
+	}
+	if err = p.probeWrite(ctx, probeZone); err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("write permission on zone %s: %v", probeZone, err))
+	}
+	return p.storeSelfTest(report)
+}
+
+// CheckSelfTest runs SelfTest in the given mode and logs the outcome,
+// only the strict mode returns an error.
+func (p *DnsProvider) CheckSelfTest(ctx context.Context, mode string) error {
+	switch mode {
+	case "", SelfTestOff:
+		return nil
+	case SelfTestWarn, SelfTestStrict:
+	default:
+		return fmt.Errorf("%s: unknown self-test mode %q", ProviderName, mode)
+	}
+	report := p.SelfTest(ctx)
+	if report.OK {
+		log.Infof("%s: self-test passed: zones=%d", ProviderName, report.Zones)
+		return nil
+	}
+	msg := strings.Join(report.Problems, "; ")
+	if mode == SelfTestStrict {
+		return fmt.Errorf("%s: %w: %s", ProviderName, ErrSelfTest, msg)
+	}
+	log.Warnf("%s: self-test failed, running degraded: %s", ProviderName, msg)
+	return nil
+}
+
+func (p *DnsProvider) storeSelfTest(report SelfTestReport) SelfTestReport {
+	report.OK = len(report.Problems) == 0
+	if p.readiness != nil {
+		p.readiness.mu.Lock()
+		p.readiness.selfTest = &report
+		p.readiness.mu.Unlock()
+	}
+	return report
+}
+
+// zoneNames lists all zones of the account without records
+func (p *DnsProvider) zoneNames(ctx context.Context) ([]string, error) {
+	res := make([]string, 0)
+	for offset := uint64(0); ; offset += selfTestZonesPage {
+		page, err := p.client.ZonesWithParam(ctx, gdns.ZonesParam{Offset: offset, Limit: selfTestZonesPage})
+		if err == nil && page.Error != "" {
+			err = errors.New(page.Error)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range page.Zones {
+			res = append(res, normalizeName(z.Name))
+		}
+		if len(page.Zones) < selfTestZonesPage {
+			return res, nil
+		}
+	}
+}
+
+// probeWrite deletes a random RRSet which does not exist, the API tells apart
+// a missing record from a token without write permission without changing anything.
+func (p *DnsProvider) probeWrite(ctx context.Context, zone string) error {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := selfTestProbeLabel + hex.EncodeToString(suffix) + "." + zone
+	err := p.client.DeleteRRSet(ctx, zone, name, "TXT")
+	apiErr := new(gdns.APIError)
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return nil
+	case errors.As(err, apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("token is not allowed to change records: %v", err)
+	}
+	return fmt.Errorf("probe %s: %s: %v", name, errorClass(err), err)
+}
+
+// parentZone returns the zone name equals to or containing name
+func parentZone(zones []string, name string) string {
+	for _, zone := range zones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return zone
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func Test_dnsProvider_SelfTest(t *testing.T) {
+	notFound := gdns.APIError{StatusCode: http.StatusNotFound, Message: "not found"}
+	forbidden := gdns.APIError{StatusCode: http.StatusForbidden, Message: "read only"}
+	tests := []struct {
+		name      string
+		filter    []string
+		listErr   error
+		deleteErr error
+		problem   string
+	}{
+		{name: "ok", filter: []string{"test.com", "sub.example.com"}, deleteErr: notFound},
+		{name: "missing zone", filter: []string{"other.com"}, deleteErr: notFound, problem: "domain filter other.com"},
+		{name: "read only token", deleteErr: forbidden, problem: "not allowed to change records"},
+		{name: "unauthorized", listErr: gdns.APIError{StatusCode: http.StatusUnauthorized}, problem: "list zones: auth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probed := ""
+			p := &DnsProvider{
+				domainFilter: endpoint.NewDomainFilter(tt.filter),
+				readiness:    newReadiness(ReadinessConfig{}),
+				client: dnsManagerMock{
+					zonesWithParam: func(ctx context.Context, param gdns.ZonesParam) (gdns.ListZones, error) {
+						return gdns.ListZones{Zones: []gdns.Zone{{Name: "example.com"}, {Name: "test.com"}}}, tt.listErr
+					},
+					deleteRRSet: func(ctx context.Context, zone, name, recordType string) error {
+						if !strings.HasPrefix(name, selfTestProbeLabel) || !strings.HasSuffix(name, "."+zone) {
+							t.Errorf("probe must use a random name inside the zone: %s %s", zone, name)
+						}
+						probed = zone
+						return tt.deleteErr
+					},
+				},
+			}
+			report := p.SelfTest(context.Background())
+			if tt.problem == "" {
+				if !report.OK || report.Zones != 2 || probed == "" {
+					t.Errorf("SelfTest() = %+v, probed=%q", report, probed)
+				}
+				return
+			}
+			if report.OK || !strings.Contains(strings.Join(report.Problems, "; "), tt.problem) {
+				t.Errorf("SelfTest() = %+v, want problem %q", report, tt.problem)
+			}
+			err := p.CheckSelfTest(context.Background(), SelfTestStrict)
+			if !errors.Is(err, ErrSelfTest) {
+				t.Errorf("CheckSelfTest() error = %v, want %v", err, ErrSelfTest)
+			}
+			if err = p.CheckSelfTest(context.Background(), SelfTestWarn); err != nil {
+				t.Errorf("CheckSelfTest() error = %v, warn mode must not fail", err)
+			}
+			p.readiness.api.OK = true
+			p.readiness.api.CheckedAt = p.readiness.now()
+			if r := p.Readiness(context.Background()); !r.Degraded || r.SelfTest == nil {
+				t.Errorf("Readiness() = %+v, want degraded", r)
+			}
+		})
+	}
+}
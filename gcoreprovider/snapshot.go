@@ -0,0 +1,504 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+const (
+	// SnapshotVersion is the format version of snapshot files
+	SnapshotVersion         = 1
+	snapshotFilePrefix      = "snapshot-"
+	snapshotFileSuffix      = ".json"
+	snapshotTimeFormat      = "20060102T150405.000000000Z"
+	snapshotConcurrency     = 10
+	defaultSnapshotsToKeep  = 20
+	snapshotBeforeDeleteTag = "before-delete"
+)
+
+var (
+	// ErrSnapshotNotFound returned when the snapshot file does not exist
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrSnapshotsDisabled returned when no snapshot directory is configured
+	ErrSnapshotsDisabled = errors.New("snapshots are not configured")
+)
+
+// Snapshot is the full state of zones: every RRSet with its records, meta and filters
+type Snapshot struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Reason    string         `json:"reason,omitempty"`
+	Zones     []ZoneSnapshot `json:"zones"`
+}
+
+// ZoneSnapshot holds RRSets of a single zone
+type ZoneSnapshot struct {
+	Name   string          `json:"name"`
+	RRSets []SnapshotRRSet `json:"rrsets"`
+}
+
+// SnapshotRRSet is a named RRSet as returned by the Gcore API
+type SnapshotRRSet struct {
+	Name  string     `json:"name"`
+	RRSet gdns.RRSet `json:"rrset"`
+}
+
+// SnapshotInfo describes a stored snapshot file
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+// SnapshotConfig enables snapshots stored in Dir
+type SnapshotConfig struct {
+	Dir string
+	// BeforeDelete takes a snapshot of affected zones before every ApplyChanges deleting records
+	BeforeDelete bool
+	// Keep is the number of snapshot files to keep, older ones are removed
+	Keep int
+}
+
+// snapshotStore keeps snapshot files in a directory
+type snapshotStore struct {
+	cfg SnapshotConfig
+	mu  sync.Mutex
+}
+
+// Snapshot reads full RRSets of the given zones, all managed zones when zones is empty
+func (p *DnsProvider) Snapshot(ctx context.Context, zones []string) (*Snapshot, error) {
+	ctx, span := startSpan(ctx, "Snapshot", attribute.StringSlice("dns.zones", zones))
+	defer span.End()
+	ctx, cancel := p.withListTimeout(ctx)
+	defer cancel()
+	var zs []gdns.Zone
+	var err error
+	if len(zones) == 0 {
+		zs, err = p.listManagedZones(ctx)
+	} else {
+		zs, err = p.client.AllZonesWithRecords(ctx, zones)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: snapshot: %w", ProviderName, err)
+	}
+	if len(zones) > 0 {
+		// the API matches names loosely, keep only requested zones
+		wanted := map[string]bool{}
+		for _, z := range zones {
+			wanted[normalizeName(z)] = true
+		}
+		filtered := zs[:0]
+		for _, z := range zs {
+			if wanted[normalizeName(z.Name)] {
+				filtered = append(filtered, z)
+			}
+		}
+		zs = filtered
+	}
+	snap := &Snapshot{Version: SnapshotVersion, CreatedAt: time.Now().UTC(), Zones: make([]ZoneSnapshot, len(zs))}
+	gr, grCtx := errgroup.WithContext(ctx)
+	gr.SetLimit(snapshotConcurrency)
+	for i, z := range zs {
+		zone := strings.Trim(z.Name, ".")
+		snap.Zones[i] = ZoneSnapshot{Name: zone, RRSets: make([]SnapshotRRSet, len(z.Records))}
+		for j, r := range z.Records {
+			i, j, r := i, j, r
+			gr.Go(func() error {
+				rrSet, err := p.client.RRSet(grCtx, zone, r.Name, r.Type)
+				if err != nil {
+					return fmt.Errorf("rrset %s %s: %w", r.Name, r.Type, err)
+				}
+				if rrSet.Type == "" {
+					rrSet.Type = r.Type
+				}
+				snap.Zones[i].RRSets[j] = SnapshotRRSet{Name: strings.Trim(r.Name, "."), RRSet: rrSet}
+				return nil
+			})
+		}
+	}
+	if err = gr.Wait(); err != nil {
+		return nil, fmt.Errorf("%s: snapshot: %w", ProviderName, err)
+	}
+	for _, z := range snap.Zones {
+		sort.Slice(z.RRSets, func(i, j int) bool {
+			return rrSetKey(z.RRSets[i].Name, z.RRSets[i].RRSet.Type) < rrSetKey(z.RRSets[j].Name, z.RRSets[j].RRSet.Type)
+		})
+	}
+	return snap, nil
+}
+
+// Restore puts the zone back to its state in snap by applying the difference,
+// with dryRun the returned operations are only planned.
+func (p *DnsProvider) Restore(rootCtx context.Context, snap *Snapshot, zone string, dryRun bool) ([]RRSetOperation, error) {
+	zone = strings.Trim(zone, ".")
+	var target *ZoneSnapshot
+	for i := range snap.Zones {
+		if snap.Zones[i].Name == zone {
+			target = &snap.Zones[i]
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s: restore: zone %s is not in the snapshot", ProviderName, zone)
+	}
+	ctx, span := startSpan(rootCtx, "Restore", attribute.String("dns.zone", zone), attribute.Bool("dns.dry_run", dryRun))
+	defer span.End()
+	ctx, cancel := p.withApplyTimeout(ctx)
+	defer cancel()
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("%s: restore: %w", ProviderName, err)
+	}
+	defer unlock()
+	current, err := p.Snapshot(ctx, []string{zone})
+	if err != nil {
+		return nil, fmt.Errorf("%s: restore: %w", ProviderName, err)
+	}
+	existing := map[string]SnapshotRRSet{}
+	size := 0
+	for _, z := range current.Zones {
+		if z.Name != zone {
+			continue
+		}
+		for _, r := range z.RRSets {
+			existing[rrSetKey(r.Name, r.RRSet.Type)] = r
+			size += len(r.RRSet.Records)
+		}
+	}
+	ops, err := p.guardOperations(diffRRSets(zone, existing, target.RRSets), map[string]int{zone: size})
+	if err != nil {
+		return nil, fmt.Errorf("%s: restore: %w", ProviderName, err)
+	}
+	if dryRun {
+		p.auditOperations(ctx, "restore", ops, true)
+		return ops, nil
+	}
+	for i, op := range ops {
+		err = p.applyRRSetOperation(ctx, op)
+		p.auditOperation(ctx, "restore", op, false, err)
+		if err != nil {
+			return ops[:i], fmt.Errorf("%s: restore %s %s %s: %w", ProviderName, op.Operation, op.Name, op.Type, err)
+		}
+		log.Infof("%s: restore %s: %s %s %s", ProviderName, zone, op.Operation, op.Name, op.Type)
+	}
+	return ops, nil
+}
+
+// diffRRSets returns operations turning existing RRSets into wanted ones
+func diffRRSets(zone string, existing map[string]SnapshotRRSet, wanted []SnapshotRRSet) []RRSetOperation {
+	ops := make([]RRSetOperation, 0)
+	seen := map[string]bool{}
+	for _, w := range wanted {
+		key := rrSetKey(w.Name, w.RRSet.Type)
+		seen[key] = true
+		after := w.RRSet
+		cur, ok := existing[key]
+		switch {
+		case !ok:
+			ops = append(ops, RRSetOperation{Change: "restore", Operation: OperationCreateRRSet,
+				Zone: zone, Name: w.Name, Type: w.RRSet.Type, After: &after})
+		case !sameRRSet(cur.RRSet, w.RRSet):
+			before := cur.RRSet
+			ops = append(ops, RRSetOperation{Change: "restore", Operation: OperationUpdateRRSet,
+				Zone: zone, Name: w.Name, Type: w.RRSet.Type, Before: &before, After: &after})
+		}
+	}
+	keys := make([]string, 0, len(existing))
+	for key := range existing {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		cur := existing[key]
+		before := cur.RRSet
+		ops = append(ops, RRSetOperation{Change: "restore", Operation: OperationDeleteRRSet,
+			Zone: zone, Name: cur.Name, Type: cur.RRSet.Type, Before: &before})
+	}
+	return ops
+}
+
+func (p *DnsProvider) applyRRSetOperation(ctx context.Context, op RRSetOperation) error {
+	switch op.Operation {
+	case OperationCreateRRSet:
+		return p.client.CreateRRSet(ctx, op.Zone, op.Name, op.Type, *op.After)
+	case OperationUpdateRRSet:
+		return p.client.UpdateRRSet(ctx, op.Zone, op.Name, op.Type, *op.After)
+	case OperationDeleteRRSet:
+		return p.client.DeleteRRSet(ctx, op.Zone, op.Name, op.Type)
+	}
+	return fmt.Errorf("unknown operation %s", op.Operation)
+}
+
+// guardOperations holds ops written outside ApplyChanges, e.g. by a restore, to the same rules:
+// protected RRSets are skipped, or refused in refuse mode, and the deletion limits apply.
+// zoneSize counts the records of the zones before ops.
+func (p *DnsProvider) guardOperations(ops []RRSetOperation, zoneSize map[string]int) ([]RRSetOperation, error) {
+	settings := p.settings()
+	res := make([]RRSetOperation, 0, len(ops))
+	var refused []string
+	for _, op := range ops {
+		if !settings.protection.protects(op.Name, op.Type) {
+			res = append(res, op)
+			continue
+		}
+		msg := fmt.Sprintf("%s %s %s", op.Operation, op.Name, op.Type)
+		refused = append(refused, msg)
+		if !settings.protection.Refuse {
+			log.Warnf("%s: skipping operation on protected record: %s", ProviderName, msg)
+		}
+	}
+	if settings.protection.Refuse && len(refused) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrProtectedRecord, strings.Join(refused, "; "))
+	}
+	zones := map[string]string{}
+	changes := &plan.Changes{}
+	for _, op := range res {
+		zones[op.Name] = op.Zone
+		if op.Before != nil {
+			old := endpoint.NewEndpointWithTTL(op.Name, op.Type, endpoint.TTL(op.Before.TTL), rrSetTargets(op.Before)...)
+			if op.After == nil {
+				changes.Delete = append(changes.Delete, old)
+				continue
+			}
+			changes.UpdateOld = append(changes.UpdateOld, old)
+			changes.UpdateNew = append(changes.UpdateNew,
+				endpoint.NewEndpointWithTTL(op.Name, op.Type, endpoint.TTL(op.After.TTL), rrSetTargets(op.After)...))
+		}
+	}
+	extractZone := func(name string) string { return zones[name] }
+	if err := settings.deletionLimits.check(changes, extractZone, zoneSize); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// auditOperation writes the outcome of op, action tells what it was done for, e.g. restore
+func (p *DnsProvider) auditOperation(ctx context.Context, action string, op RRSetOperation, dryRun bool, err error) {
+	ttl := 0
+	for _, r := range []*gdns.RRSet{op.Before, op.After} {
+		if r != nil {
+			ttl = r.TTL
+		}
+	}
+	p.auditOp(ctx, action, op.Zone, op.Name, op.Type, rrSetTargets(op.Before), rrSetTargets(op.After),
+		int64(ttl), dryRun, err)
+}
+
+func (p *DnsProvider) auditOperations(ctx context.Context, action string, ops []RRSetOperation, dryRun bool) {
+	for _, op := range ops {
+		p.auditOperation(ctx, action, op, dryRun, nil)
+	}
+}
+
+// rrSetTargets returns the record values of r, nil for a missing RRSet
+func rrSetTargets(r *gdns.RRSet) []string {
+	if r == nil {
+		return nil
+	}
+	res := make([]string, 0, len(r.Records))
+	for _, v := range r.Records {
+		res = append(res, v.ContentToString())
+	}
+	return res
+}
+
+// sameRRSet compares the TTL and the records of a and b as a set of values,
+// the API does not keep the order of records in an RRSet
+func sameRRSet(a, b gdns.RRSet) bool {
+	if a.TTL != b.TTL || len(a.Records) != len(b.Records) {
+		return false
+	}
+	ak, bk := recordKeys(a), recordKeys(b)
+	for i := range ak {
+		if ak[i] != bk[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// recordKeys returns the sorted record values of r, disabled ones marked as such
+func recordKeys(r gdns.RRSet) []string {
+	res := make([]string, 0, len(r.Records))
+	for _, v := range r.Records {
+		key := v.ContentToString()
+		if !v.Enabled {
+			key += " (disabled)"
+		}
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func rrSetKey(name, recordType string) string {
+	return normalizeName(name) + " " + strings.ToUpper(recordType)
+}
+
+// save writes snap as a new versioned file and prunes old ones
+func (s *snapshotStore) save(snap *Snapshot) (SnapshotInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.cfg.Dir, 0o700); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("snapshot dir: %w", err)
+	}
+	bs, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("encode snapshot: %w", err)
+	}
+	name := snapshotFilePrefix + snap.CreatedAt.UTC().Format(snapshotTimeFormat)
+	if snap.Reason != "" {
+		name += "-" + snap.Reason
+	}
+	name += snapshotFileSuffix
+	path := filepath.Join(s.cfg.Dir, name)
+	if err = os.WriteFile(path+".tmp", bs, 0o600); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("write snapshot: %w", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("write snapshot: %w", err)
+	}
+	s.prune()
+	return SnapshotInfo{Name: name, CreatedAt: snap.CreatedAt, Size: int64(len(bs))}, nil
+}
+
+// prune removes the oldest files above Keep, must be called with mu held
+func (s *snapshotStore) prune() {
+	keep := s.cfg.Keep
+	if keep <= 0 {
+		keep = defaultSnapshotsToKeep
+	}
+	infos, err := s.listLocked()
+	if err != nil || len(infos) <= keep {
+		return
+	}
+	for _, info := range infos[keep:] {
+		if err = os.Remove(filepath.Join(s.cfg.Dir, info.Name)); err != nil {
+			log.Warnf("%s: prune snapshot %s: %v", ProviderName, info.Name, err)
+		}
+	}
+}
+
+func (s *snapshotStore) list() ([]SnapshotInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked()
+}
+
+// listLocked returns snapshot files, newest first
+func (s *snapshotStore) listLocked() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []SnapshotInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	res := make([]SnapshotInfo, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, snapshotFilePrefix) || !strings.HasSuffix(name, snapshotFileSuffix) {
+			continue
+		}
+		ts := strings.TrimPrefix(name, snapshotFilePrefix)
+		if len(ts) < len(snapshotTimeFormat) {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeFormat, ts[:len(snapshotTimeFormat)])
+		if err != nil {
+			continue
+		}
+		info := SnapshotInfo{Name: name, CreatedAt: createdAt}
+		if fi, err := e.Info(); err == nil {
+			info.Size = fi.Size()
+		}
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name > res[j].Name })
+	return res, nil
+}
+
+func (s *snapshotStore) load(name string) (*Snapshot, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, snapshotFilePrefix) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	bs, err := os.ReadFile(filepath.Join(s.cfg.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	snap := &Snapshot{}
+	if err = json.Unmarshal(bs, snap); err != nil {
+		return nil, fmt.Errorf("decode snapshot %s: %w", name, err)
+	}
+	if snap.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot %s: unsupported version %d", name, snap.Version)
+	}
+	return snap, nil
+}
+
+// SaveSnapshot takes a snapshot of zones, all managed zones when empty, and stores it
+func (p *DnsProvider) SaveSnapshot(ctx context.Context, zones []string, reason string) (SnapshotInfo, error) {
+	if p.snapshots == nil {
+		return SnapshotInfo{}, fmt.Errorf("%s: %w", ProviderName, ErrSnapshotsDisabled)
+	}
+	snap, err := p.Snapshot(ctx, zones)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	snap.Reason = reason
+	info, err := p.snapshots.save(snap)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("%s: %w", ProviderName, err)
+	}
+	log.Infof("%s: saved snapshot %s of zones=%v", ProviderName, info.Name, zones)
+	return info, nil
+}
+
+// Snapshots lists stored snapshots, newest first
+func (p *DnsProvider) Snapshots() ([]SnapshotInfo, error) {
+	if p.snapshots == nil {
+		return nil, fmt.Errorf("%s: %w", ProviderName, ErrSnapshotsDisabled)
+	}
+	return p.snapshots.list()
+}
+
+// RestoreSnapshot restores zone from the stored snapshot file name
+func (p *DnsProvider) RestoreSnapshot(ctx context.Context, name, zone string, dryRun bool) ([]RRSetOperation, error) {
+	if p.snapshots == nil {
+		return nil, fmt.Errorf("%s: %w", ProviderName, ErrSnapshotsDisabled)
+	}
+	snap, err := p.snapshots.load(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ProviderName, err)
+	}
+	return p.Restore(ctx, snap, zone, dryRun)
+}
+
+// snapshotBeforeDelete stores affected zones before ApplyChanges deletes anything
+func (p *DnsProvider) snapshotBeforeDelete(ctx context.Context, zones []string) error {
+	if p.snapshots == nil || !p.snapshots.cfg.BeforeDelete || p.dryRun || len(zones) == 0 {
+		return nil
+	}
+	_, err := p.SaveSnapshot(ctx, uniqueSorted(zones), snapshotBeforeDeleteTag)
+	return err
+}
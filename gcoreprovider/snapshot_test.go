@@ -0,0 +1,190 @@
+package gcoreprovider
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_dnsProvider_snapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryDNS("test.com")
+	_ = client.AddZoneRRSet(ctx, "test.com", "my.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+	}, 10)
+	_ = client.UpdateRRSet(ctx, "test.com", "geo.test.com", "A", gdns.RRSet{
+		Type: "A", TTL: 60,
+		Records: []gdns.ResourceRecord{{Content: []any{"2.2.2.2"}, Meta: map[string]any{"countries": []any{"DE"}}, Enabled: true}},
+		Filters: []gdns.RecordFilter{{Type: "geodistance", Limit: 1}},
+	})
+	dir := t.TempDir()
+	p := &DnsProvider{client: client}
+	WithSnapshots(SnapshotConfig{Dir: dir, BeforeDelete: true})(p)
+
+	// deleting records takes a snapshot first
+	err := p.ApplyChanges(ctx, &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("my.test.com", "A", "1.1.1.1"),
+			endpoint.NewEndpoint("geo.test.com", "A", "2.2.2.2"),
+		},
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.test.com", "A", 10, "3.3.3.3")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	infos, err := p.Snapshots()
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("Snapshots() = %v, %v", infos, err)
+	}
+	snap, err := p.snapshots.load(infos[0].Name)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if snap.Version != SnapshotVersion || len(snap.Zones) != 1 || len(snap.Zones[0].RRSets) != 2 {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+
+	// dry-run restore only plans
+	ops, err := p.RestoreSnapshot(ctx, infos[0].Name, "test.com", true)
+	if err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	want := map[string]string{
+		"geo.test.com": OperationCreateRRSet,
+		"my.test.com":  OperationCreateRRSet,
+		"new.test.com": OperationDeleteRRSet,
+	}
+	if len(ops) != len(want) {
+		t.Fatalf("RestoreSnapshot() = %+v", ops)
+	}
+	for _, op := range ops {
+		if want[op.Name] != op.Operation {
+			t.Errorf("operation for %s = %s, want %s", op.Name, op.Operation, want[op.Name])
+		}
+	}
+	if _, err = client.RRSet(ctx, "test.com", "new.test.com", "A"); err != nil {
+		t.Fatalf("dry-run restore must not write: %v", err)
+	}
+
+	if _, err = p.RestoreSnapshot(ctx, infos[0].Name, "test.com", false); err != nil {
+		t.Fatalf("RestoreSnapshot() error = %v", err)
+	}
+	if _, err = client.RRSet(ctx, "test.com", "new.test.com", "A"); err == nil {
+		t.Errorf("new.test.com must be deleted")
+	}
+	geo, err := client.RRSet(ctx, "test.com", "geo.test.com", "A")
+	if err != nil || len(geo.Filters) != 1 || geo.Records[0].Meta["countries"] == nil {
+		t.Errorf("geo.test.com = %+v, %v, meta and filters must be restored", geo, err)
+	}
+	if ops, _ = p.RestoreSnapshot(ctx, infos[0].Name, "test.com", true); len(ops) != 0 {
+		t.Errorf("restored zone must have no difference: %+v", ops)
+	}
+
+	if _, err = p.RestoreSnapshot(ctx, "../etc/passwd", "test.com", true); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("RestoreSnapshot() error = %v, want %v", err, ErrSnapshotNotFound)
+	}
+}
+
+func Test_snapshotStore_prune(t *testing.T) {
+	s := &snapshotStore{cfg: SnapshotConfig{Dir: t.TempDir(), Keep: 2}}
+	snap := &Snapshot{Version: SnapshotVersion}
+	for i := 0; i < 4; i++ {
+		snap.CreatedAt = snap.CreatedAt.Add(1e9)
+		if _, err := s.save(snap); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+	}
+	infos, err := s.list()
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("list() = %v, %v", infos, err)
+	}
+	if !infos[0].CreatedAt.After(infos[1].CreatedAt) {
+		t.Errorf("list() must be newest first: %v", infos)
+	}
+}
+
+func Test_dnsProvider_restoreGuarded(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-1")
+	client := newMemoryDNS("test.com")
+	for _, name := range []string{"a.test.com", "b.test.com", "mail.test.com"} {
+		_ = client.AddZoneRRSet(ctx, "test.com", name, "A", []gdns.ResourceRecord{
+			*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+		}, 10)
+	}
+	snap := &Snapshot{Version: SnapshotVersion, Zones: []ZoneSnapshot{{Name: "test.com"}}}
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	protection, _ := NewProtectionRules([]string{"mail.test.com"})
+	p := &DnsProvider{client: client}
+	WithProtectionRules(protection)(p)
+	p.audit, _ = newAuditLog(AuditConfig{Path: auditPath})
+	defer p.audit.Close()
+
+	// a restore to an empty zone is held to the deletion limits
+	WithDeletionLimits(DeletionLimits{MaxDeletes: 1})(p)
+	if _, err := p.Restore(ctx, snap, "test.com", false); !errors.Is(err, ErrDeletionLimit) {
+		t.Fatalf("Restore() error = %v, want deletion limit", err)
+	}
+
+	// protected RRSets are skipped
+	WithDeletionLimits(DeletionLimits{})(p)
+	ops, err := p.Restore(ctx, snap, "test.com", false)
+	if err != nil || len(ops) != 2 {
+		t.Fatalf("Restore() = %+v, %v", ops, err)
+	}
+	if _, err = client.RRSet(ctx, "test.com", "mail.test.com", "A"); err != nil {
+		t.Errorf("protected mail.test.com deleted by restore: %v", err)
+	}
+	entries := readAudit(t, auditPath)
+	if len(entries) != 2 {
+		t.Fatalf("audit entries = %+v", entries)
+	}
+	for _, e := range entries {
+		if e.Action != "restore" || e.RequestID != "req-1" || e.Outcome != AuditOutcomeSuccess || len(e.OldTargets) != 1 {
+			t.Errorf("audit entry = %+v", e)
+		}
+	}
+
+	// or refuse the whole restore
+	protection.Refuse = true
+	WithProtectionRules(protection)(p)
+	if _, err = p.Restore(ctx, snap, "test.com", true); !errors.Is(err, ErrProtectedRecord) {
+		t.Errorf("Restore() error = %v, want protected record", err)
+	}
+}
+
+func Test_dnsProvider_snapshotBeforeUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryDNS("test.com", "other.com")
+	_ = client.AddZoneRRSet(ctx, "test.com", "my.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+	}, 10)
+	p := &DnsProvider{client: client, domainFilter: endpoint.NewDomainFilter([]string{"test.com"})}
+	WithSnapshots(SnapshotConfig{Dir: t.TempDir(), BeforeDelete: true})(p)
+
+	// adding a target deletes nothing
+	err := p.ApplyChanges(ctx, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.1", "1.1.1.2")},
+	})
+	if infos, _ := p.Snapshots(); err != nil || len(infos) != 0 {
+		t.Fatalf("snapshots = %v, %v, want none", infos, err)
+	}
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.1", "1.1.1.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.3")},
+	})
+	if infos, _ := p.Snapshots(); err != nil || len(infos) != 1 {
+		t.Fatalf("snapshots = %v, %v, want one before removing targets", infos, err)
+	}
+
+	// all zones are the managed ones
+	snap, err := p.Snapshot(ctx, nil)
+	if err != nil || len(snap.Zones) != 1 || snap.Zones[0].Name != "test.com" {
+		t.Errorf("Snapshot() = %+v, %v, want test.com only", snap, err)
+	}
+}
@@ -0,0 +1,304 @@
+package gcoreprovider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// janitor looks for expired soft-deleted records at most this often
+	maxJanitorInterval = time.Minute
+	minJanitorInterval = time.Second
+	// janitorRequestID tags logs and audit entries of purges, they don't belong to a request
+	janitorRequestID = "janitor"
+)
+
+// softDeleted is a record value disabled instead of deleted by ApplyChanges
+type softDeleted struct {
+	Zone      string    `json:"zone"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Content   string    `json:"content"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+func (s softDeleted) key() string {
+	return softDeletedKey(s.Zone, s.Name, s.Type, s.Content)
+}
+
+func softDeletedKey(zone, name, recordType, content string) string {
+	return strings.Join([]string{normalizeName(zone), normalizeName(name), strings.ToUpper(recordType), content}, " ")
+}
+
+// softDeleter disables deleted records first and lets a janitor purge them
+// after the grace period, re-creating a record during it re-enables the disabled one.
+type softDeleter struct {
+	grace time.Duration
+	// file persists disabled records between restarts, without it they would stay disabled
+	// and hidden after a restart and never be purged
+	file  string
+	mu    sync.Mutex
+	items map[string]softDeleted
+	now   func() time.Time
+}
+
+func newSoftDeleter(grace time.Duration, file string) (*softDeleter, error) {
+	if file == "" {
+		return nil, EnvError(EnvSoftDeleteState + " is required with " + EnvSoftDeleteGrace)
+	}
+	s := &softDeleter{grace: grace, file: file, items: map[string]softDeleted{}, now: time.Now}
+	bs, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read soft delete state: %w", err)
+	}
+	items := make([]softDeleted, 0)
+	if err = json.Unmarshal(bs, &items); err != nil {
+		return nil, fmt.Errorf("decode soft delete state %s: %w", file, err)
+	}
+	for _, item := range items {
+		s.items[item.key()] = item
+	}
+	return s, nil
+}
+
+// save writes the state file, must be called with mu held
+func (s *softDeleter) save() {
+	items := make([]softDeleted, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key() < items[j].key() })
+	bs, err := json.MarshalIndent(items, "", "  ")
+	if err == nil {
+		tmp := s.file + ".tmp"
+		if err = os.WriteFile(tmp, bs, 0o600); err == nil {
+			err = os.Rename(tmp, s.file)
+		}
+	}
+	if err != nil {
+		log.Errorf("%s: save soft delete state %s: %v", ProviderName, s.file, err)
+	}
+}
+
+func (s *softDeleter) isDeleted(zone, name, recordType, content string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.items[softDeletedKey(zone, name, recordType, content)]
+	return ok
+}
+
+// disable sets enabled=false on record values instead of deleting them
+func (s *softDeleter) disable(ctx context.Context, client dnsManager,
+	zone, name, recordType string, contents []string) error {
+	if len(contents) == 0 {
+		return nil
+	}
+	changed, err := setEnabled(ctx, client, zone, name, recordType, contents, false)
+	if err != nil {
+		return fmt.Errorf("soft delete: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, content := range changed {
+		item := softDeleted{Zone: zone, Name: name, Type: recordType, Content: content, DeletedAt: s.now()}
+		s.items[item.key()] = item
+	}
+	s.save()
+	return nil
+}
+
+// restore re-enables soft-deleted record values and returns the values still to be created
+func (s *softDeleter) restore(ctx context.Context, client dnsManager,
+	zone, name, recordType string, values []gdns.ResourceRecord) ([]gdns.ResourceRecord, error) {
+	toRestore := make([]string, 0)
+	rest := make([]gdns.ResourceRecord, 0, len(values))
+	for _, v := range values {
+		if content := v.ContentToString(); s.isDeleted(zone, name, recordType, content) {
+			toRestore = append(toRestore, content)
+			continue
+		}
+		rest = append(rest, v)
+	}
+	if len(toRestore) == 0 {
+		return rest, nil
+	}
+	restored, err := setEnabled(ctx, client, zone, name, recordType, toRestore, true)
+	if err != nil {
+		return nil, fmt.Errorf("restore soft deleted: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, content := range toRestore {
+		delete(s.items, softDeletedKey(zone, name, recordType, content))
+	}
+	s.save()
+	log.Infof("%s: re-enabled soft deleted %s %s %v", ProviderName, name, recordType, restored)
+	// values which disappeared meanwhile are created again
+	for _, v := range values {
+		if content := v.ContentToString(); contains(toRestore, content) && !contains(restored, content) {
+			rest = append(rest, v)
+		}
+	}
+	return rest, nil
+}
+
+// filterRecords hides soft-deleted targets from external-dns
+func (s *softDeleter) filterRecords(zone string, e *endpoint.Endpoint) *endpoint.Endpoint {
+	targets := make(endpoint.Targets, 0, len(e.Targets))
+	for _, t := range e.Targets {
+		if !s.isDeleted(zone, e.DNSName, e.RecordType, t) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	e.Targets = targets
+	return e
+}
+
+// expired returns soft-deleted values past the grace period grouped by RRSet
+func (s *softDeleter) expired() map[softDeleted][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[softDeleted][]string{}
+	for _, item := range s.items {
+		if s.now().Sub(item.DeletedAt) < s.grace {
+			continue
+		}
+		rrSet := softDeleted{Zone: item.Zone, Name: item.Name, Type: item.Type}
+		res[rrSet] = append(res[rrSet], item.Content)
+	}
+	return res
+}
+
+func (s *softDeleter) forget(zone, name, recordType string, contents []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, content := range contents {
+		delete(s.items, softDeletedKey(zone, name, recordType, content))
+	}
+	s.save()
+}
+
+func (s *softDeleter) interval() time.Duration {
+	interval := s.grace / 4
+	if interval > maxJanitorInterval {
+		return maxJanitorInterval
+	}
+	if interval < minJanitorInterval {
+		return minJanitorInterval
+	}
+	return interval
+}
+
+// runJanitor purges expired soft-deleted records until ctx is done
+func (p *DnsProvider) runJanitor(ctx context.Context) {
+	ticker := time.NewTicker(p.softDelete.interval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.purgeSoftDeleted(ctx)
+		}
+	}
+}
+
+func (p *DnsProvider) purgeSoftDeleted(rootCtx context.Context) {
+	rootCtx = WithRequestID(rootCtx, janitorRequestID)
+	for rrSet, contents := range p.softDelete.expired() {
+		ctx, cancel := p.withApplyTimeout(rootCtx)
+		err := p.purgeRRSet(ctx, rrSet.Zone, rrSet.Name, rrSet.Type, contents)
+		cancel()
+		if err != nil {
+			log.Errorf("%s: purge soft deleted %s %s %v: %v", ProviderName, rrSet.Name, rrSet.Type, contents, err)
+		}
+	}
+}
+
+// purgeRRSet deletes values that are still disabled, values enabled meanwhile by hand are kept
+func (p *DnsProvider) purgeRRSet(ctx context.Context, zone, name, recordType string, contents []string) error {
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	rrSet, err := p.client.RRSet(ctx, zone, name, recordType)
+	if err != nil {
+		apiErr := new(gdns.APIError)
+		if errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			p.softDelete.forget(zone, name, recordType, contents)
+			return nil
+		}
+		return err
+	}
+	toDelete := make([]string, 0, len(contents))
+	for _, r := range rrSet.Records {
+		if content := r.ContentToString(); !r.Enabled && contains(contents, content) {
+			toDelete = append(toDelete, content)
+		}
+	}
+	if len(toDelete) > 0 {
+		err = p.client.DeleteRRSetRecord(ctx, zone, name, recordType, toDelete...)
+		p.auditOp(ctx, "purge", zone, name, recordType, toDelete, nil, int64(rrSet.TTL), false, err)
+		if err != nil {
+			return err
+		}
+		log.Infof("%s: purged soft deleted %s %s %v", ProviderName, name, recordType, toDelete)
+	}
+	p.softDelete.forget(zone, name, recordType, contents)
+	return nil
+}
+
+// setEnabled toggles matching record values and returns contents that were found
+func setEnabled(ctx context.Context, client dnsManager,
+	zone, name, recordType string, contents []string, enabled bool) ([]string, error) {
+	rrSet, err := client.RRSet(ctx, zone, name, recordType)
+	if err != nil {
+		apiErr := new(gdns.APIError)
+		if errors.As(err, apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("rrset: %w", err)
+	}
+	found := make([]string, 0, len(contents))
+	for i, r := range rrSet.Records {
+		if content := r.ContentToString(); contains(contents, content) {
+			rrSet.Records[i].Enabled = enabled
+			found = append(found, content)
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	if err = client.UpdateRRSet(ctx, zone, name, recordType, rrSet); err != nil {
+		return nil, fmt.Errorf("update rrset: %w", err)
+	}
+	return found, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
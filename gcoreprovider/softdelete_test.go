@@ -0,0 +1,135 @@
+package gcoreprovider
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func Test_dnsProvider_softDelete(t *testing.T) {
+	ctx := context.Background()
+	state := filepath.Join(t.TempDir(), "soft-delete.json")
+	client := newMemoryDNS("test.com")
+	_ = client.AddZoneRRSet(ctx, "test.com", "my.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.2"),
+	}, 10)
+	softDelete, err := newSoftDeleter(time.Hour, state)
+	if err != nil {
+		t.Fatalf("newSoftDeleter() error = %v", err)
+	}
+	now := time.Now()
+	softDelete.now = func() time.Time { return now }
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := newAuditLog(AuditConfig{Path: auditPath})
+	if err != nil {
+		t.Fatalf("newAuditLog() error = %v", err)
+	}
+	p := &DnsProvider{client: client, softDelete: softDelete, audit: audit}
+
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("my.test.com", "A", "1.1.1.1", "1.1.1.2")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	rrSet, _ := client.RRSet(ctx, "test.com", "my.test.com", "A")
+	if len(rrSet.Records) != 2 || rrSet.Records[0].Enabled || rrSet.Records[1].Enabled {
+		t.Fatalf("records must be disabled: %+v", rrSet.Records)
+	}
+	if records, _ := p.Records(ctx); len(records) != 0 {
+		t.Errorf("Records() = %v, soft deleted must be hidden", records)
+	}
+
+	// re-create during the grace period re-enables the record
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.2")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	rrSet, _ = client.RRSet(ctx, "test.com", "my.test.com", "A")
+	if len(rrSet.Records) != 2 || rrSet.Records[0].Enabled || !rrSet.Records[1].Enabled {
+		t.Fatalf("1.1.1.2 must be re-enabled: %+v", rrSet.Records)
+	}
+	records, _ := p.Records(ctx)
+	if len(records) != 1 || len(records[0].Targets) != 1 || records[0].Targets[0] != "1.1.1.2" {
+		t.Errorf("Records() = %v", records)
+	}
+
+	// state survives restarts
+	restarted, err := newSoftDeleter(time.Hour, state)
+	if err != nil {
+		t.Fatalf("newSoftDeleter() error = %v", err)
+	}
+	if !restarted.isDeleted("test.com", "my.test.com", "A", "1.1.1.1") ||
+		restarted.isDeleted("test.com", "my.test.com", "A", "1.1.1.2") {
+		t.Errorf("restored state = %+v", restarted.items)
+	}
+
+	// janitor purges after the grace period only
+	p.purgeSoftDeleted(ctx)
+	if rrSet, _ = client.RRSet(ctx, "test.com", "my.test.com", "A"); len(rrSet.Records) != 2 {
+		t.Fatalf("purged before grace period: %+v", rrSet.Records)
+	}
+	now = now.Add(2 * time.Hour)
+	p.purgeSoftDeleted(ctx)
+	rrSet, _ = client.RRSet(ctx, "test.com", "my.test.com", "A")
+	if len(rrSet.Records) != 1 || rrSet.Records[0].ContentToString() != "1.1.1.2" {
+		t.Errorf("records after purge = %+v", rrSet.Records)
+	}
+	if len(softDelete.items) != 0 {
+		t.Errorf("soft deleted after purge = %+v", softDelete.items)
+	}
+	entries := readAudit(t, auditPath)
+	purge := entries[len(entries)-1]
+	if purge.Action != "purge" || purge.RequestID != janitorRequestID || purge.Outcome != AuditOutcomeSuccess ||
+		len(purge.OldTargets) != 1 || purge.OldTargets[0] != "1.1.1.1" {
+		t.Errorf("audit entry of the purge = %+v", purge)
+	}
+}
+
+func Test_dnsProvider_softDeleteUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := newMemoryDNS("test.com")
+	_ = client.AddZoneRRSet(ctx, "test.com", "my.test.com", "A", []gdns.ResourceRecord{
+		*(&gdns.ResourceRecord{Enabled: true}).SetContent("A", "1.1.1.1"),
+	}, 10)
+	softDelete, err := newSoftDeleter(time.Hour, filepath.Join(t.TempDir(), "soft-delete.json"))
+	if err != nil {
+		t.Fatalf("newSoftDeleter() error = %v", err)
+	}
+	p := &DnsProvider{client: client, softDelete: softDelete}
+	err = p.ApplyChanges(ctx, &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("my.test.com", "A", 10, "1.1.1.3")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	rrSet, _ := client.RRSet(ctx, "test.com", "my.test.com", "A")
+	enabled := map[string]bool{}
+	for _, r := range rrSet.Records {
+		enabled[r.ContentToString()] = r.Enabled
+	}
+	if len(enabled) != 2 || enabled["1.1.1.1"] || !enabled["1.1.1.3"] {
+		t.Errorf("records after update = %+v, want 1.1.1.1 disabled", rrSet.Records)
+	}
+	if !softDelete.isDeleted("test.com", "my.test.com", "A", "1.1.1.1") {
+		t.Error("target removed by the update is not soft deleted")
+	}
+	if records, _ := p.Records(ctx); len(records) != 1 || len(records[0].Targets) != 1 || records[0].Targets[0] != "1.1.1.3" {
+		t.Errorf("Records() = %v", records)
+	}
+}
+
+func Test_newSoftDeleter_stateRequired(t *testing.T) {
+	if _, err := newSoftDeleter(time.Hour, ""); err == nil {
+		t.Error("newSoftDeleter() without a state file must fail")
+	}
+}
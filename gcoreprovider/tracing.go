@@ -0,0 +1,92 @@
+package gcoreprovider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TracesExporterNone disables tracing
+	TracesExporterNone = "none"
+	// TracesExporterOTLP sends spans over OTLP/HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables
+	TracesExporterOTLP = "otlp"
+
+	tracerName         = "github.com/G-Core/external-dns-gcore-webhook/gcoreprovider"
+	defaultServiceName = "external-dns-gcore-webhook"
+)
+
+// SetupTracing installs the global tracer provider and the W3C trace context propagator,
+// the returned func flushes pending spans on shutdown.
+func SetupTracing(ctx context.Context, exporter, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	switch exporter {
+	case "", TracesExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TracesExporterOTLP:
+	default:
+		return nil, fmt.Errorf("%s: unknown traces exporter %q", ProviderName, exporter)
+	}
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: otlp exporter: %w", ProviderName, err)
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override these defaults
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(defaultServiceName), semconv.ServiceVersion(version)),
+		resource.Default(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: tracing resource: %w", ProviderName, err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func rrSetAttrs(zone, name, recordType string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("dns.zone", zone),
+		attribute.String("dns.name", name),
+		attribute.String("dns.type", recordType),
+	}
+}
+
+// traceTransport makes every Gcore API request a client span
+func traceTransport(c *gdns.Client) {
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{}
+	}
+	base := c.HTTPClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.HTTPClient.Transport = otelhttp.NewTransport(base,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "gcore " + r.Method + " " + r.URL.Path
+		}))
+}
@@ -0,0 +1,77 @@
+package gcoreprovider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	gdns "github.com/G-Core/gcore-dns-sdk-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func Test_dnsProvider_tracing(t *testing.T) {
+	recorder := withSpanRecorder(t)
+	p := &DnsProvider{client: &instrumentedClient{dnsManager: newMemoryDNS("test.com")}, locker: newZoneLocker(1)}
+	err := p.ApplyChanges(context.Background(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.test.com", "A", 10, "1.1.1.1")},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges() error = %v", err)
+	}
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = s
+	}
+	apply, ok := spans["ApplyChanges"]
+	if !ok {
+		t.Fatalf("no ApplyChanges span in %v", spans)
+	}
+	for _, name := range []string{"ManagedZones", "LockZones", "gcore.add_zone_rrset"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span", name)
+			continue
+		}
+		if s.SpanContext().TraceID() != apply.SpanContext().TraceID() {
+			t.Errorf("%s is not in the ApplyChanges trace", name)
+		}
+	}
+}
+
+func Test_traceTransport(t *testing.T) {
+	withSpanRecorder(t)
+	traceparent := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer srv.Close()
+	c := gdns.NewClient(gdns.PermanentAPIKeyAuth("token"))
+	c.BaseURL, _ = url.Parse(srv.URL)
+	traceTransport(c)
+	if _, err := c.ZonesWithParam(context.Background(), gdns.ZonesParam{Limit: 1}); err != nil {
+		t.Fatalf("ZonesWithParam() error = %v", err)
+	}
+	if traceparent == "" {
+		t.Errorf("trace context must be propagated to the Gcore API")
+	}
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	stdlog "log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,7 +24,14 @@ import (
 	"github.com/G-Core/external-dns-gcore-webhook/gcoreprovider"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 )
@@ -34,69 +50,375 @@ const banner = `
 
 `
 
-var (
-	Version    = "v0.0.1"
-	ApiUrl     = ``
-	ApiKey     = ``
-	ServerHost = ``
-	ServerPort = `8080`
-	DryRun     = false
-)
+var Version = "v0.0.1"
 
 func main() {
-	log.SetLevel(log.DebugLevel)
+	cfg, printConfig, err := loadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if printConfig {
+		if err := cfg.print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		return
+	}
 	fmt.Printf(banner, Version)
-	ApiUrl = os.Getenv(gcoreprovider.EnvAPIURL)
-	ApiKey = os.Getenv(gcoreprovider.EnvAPIToken)
-	ServerHost = os.Getenv(`SERVER_HOST`)
-	ServerPort = os.Getenv(`SERVER_PORT`)
-	if ServerPort == `` {
-		ServerPort = `8888`
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	redactor := gcoreprovider.NewRedactor(cfg.APIToken, cfg.ServerAuth.BearerToken, cfg.ServerAuth.HMACSecret)
+	if err := setupLogging(cfg.LogLevel, cfg.LogFormat, redactor); err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	if cfg.File != "" {
+		log.Infof("loaded configuration file %s", cfg.File)
 	}
-	DryRun = os.Getenv(`DRY_RUN`) == `true`
 
-	provider, err := gcoreprovider.NewProvider(endpoint.DomainFilter{}, ApiUrl, ApiKey, DryRun)
+	shutdownTracing, err := gcoreprovider.SetupTracing(context.Background(), cfg.TracesExporter, Version)
 	if err != nil {
-		log.Fatalf("Failed to initialize DNS provider: %v", err)
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
-	server := CreateWebServer(provider)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	tenants := cfg.tenants()
+	for _, t := range tenants {
+		if err = t.start(context.Background(), registry, len(cfg.Tenants) > 0, redactor); err != nil {
+			log.Fatalf("Failed to start DNS provider of tenant %s: %v", t.name, err)
+		}
+	}
+	if len(cfg.Tenants) > 0 {
+		logTenants(tenants)
+	}
+	server, err := CreateWebServer(tenants, registry)
+	if err != nil {
+		log.Fatalf("Failed to start the webhook listener: %v", err)
+	}
+	server.reload = (&reloader{started: cfg, tenants: tenants, redactor: redactor}).reload
 	server.Start()
+	for _, t := range tenants {
+		t.provider.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err = shutdownTracing(ctx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
+	}
+	cancel()
+}
+
+// providerOptions turns the configuration into provider options, metrics are added by the caller
+func providerOptions(cfg Config) ([]gcoreprovider.Option, error) {
+	protection, err := gcoreprovider.NewProtectionRules(cfg.ProtectedRecords)
+	if err != nil {
+		return nil, fmt.Errorf("protected records: %w", err)
+	}
+	protection.Refuse = cfg.ProtectedRefuse
+	protection.Hide = cfg.ProtectedHide
+	maxRecordsAge := cfg.ReadinessMaxRecordsAge
+	if maxRecordsAge == 0 {
+		maxRecordsAge = -1 // "0" disables the check
+	}
+	opts := []gcoreprovider.Option{
+		gcoreprovider.WithTimeouts(cfg.ListTimeout, cfg.ApplyTimeout),
+		gcoreprovider.WithAPIDebug(cfg.APIDebug),
+		gcoreprovider.WithTokenFile(gcoreprovider.TokenFileConfig{
+			Path:     cfg.APITokenFile,
+			Interval: cfg.APITokenFileInterval,
+		}),
+		gcoreprovider.WithHTTPClient(gcoreprovider.HTTPClientConfig{
+			ProxyURL:            cfg.HTTPProxy,
+			CAFile:              cfg.HTTPCAFile,
+			Timeout:             cfg.HTTPTimeout,
+			DialTimeout:         cfg.HTTPDialTimeout,
+			TLSHandshakeTimeout: cfg.HTTPTLSHandshakeTimeout,
+			IdleConnTimeout:     cfg.HTTPIdleConnTimeout,
+			UserAgent:           cfg.HTTPUserAgent,
+		}),
+		gcoreprovider.WithAuth(gcoreprovider.AuthConfig{
+			Mode:          cfg.AuthMode,
+			Command:       cfg.APITokenCommand,
+			RefreshBefore: cfg.TokenRefreshBefore,
+		}),
+		gcoreprovider.WithApplyQueueLength(cfg.ApplyQueueLength),
+		gcoreprovider.WithDeletionLimits(gcoreprovider.DeletionLimits{
+			MaxDeletes:      cfg.MaxDeletes,
+			MaxZoneShare:    cfg.MaxDeleteShare,
+			AllowMassDelete: cfg.AllowMassDelete,
+		}),
+		gcoreprovider.WithProtectionRules(protection),
+		gcoreprovider.WithSoftDelete(cfg.SoftDeleteGrace, cfg.SoftDeleteState),
+		gcoreprovider.WithDryRunPlanFile(cfg.DryRunPlanFile),
+		gcoreprovider.WithAuditLog(gcoreprovider.AuditConfig{
+			Path:       cfg.AuditLog,
+			MaxSize:    int64(cfg.AuditLogMaxSizeMB) << 20,
+			MaxBackups: cfg.AuditLogBackups,
+		}),
+		gcoreprovider.WithSnapshots(gcoreprovider.SnapshotConfig{
+			Dir:          cfg.SnapshotDir,
+			BeforeDelete: cfg.SnapshotBeforeDelete,
+			Keep:         cfg.SnapshotKeep,
+		}),
+		gcoreprovider.WithReadiness(gcoreprovider.ReadinessConfig{
+			CacheTTL:      cfg.ReadinessCacheTTL,
+			MaxRecordsAge: maxRecordsAge,
+		}),
+	}
+	if len(cfg.Accounts) > 0 {
+		opts = append(opts, gcoreprovider.WithAccounts(accountsValue(cfg.Accounts).options()...))
+	}
+	if cfg.Journal {
+		opts = append(opts, gcoreprovider.WithJournal(gcoreprovider.JournalConfig{
+			Size: cfg.JournalSize,
+			File: cfg.JournalFile,
+		}))
+	}
+	return opts, nil
 }
 
+// reloader applies a changed configuration to the running webhook
+type reloader struct {
+	started  Config
+	tenants  []*tenant
+	redactor *gcoreprovider.Redactor
+}
+
+// reload reads the configuration again, an invalid one is rejected and the current one stays active.
+// Settings without reload support are logged and keep their startup values, as do added or removed tenants.
+func (r *reloader) reload() {
+	cfg, _, err := loadConfig(os.Args[1:], os.Getenv, io.Discard)
+	if err != nil {
+		log.Errorf("Rejected configuration reload, keeping the current configuration: %v", err)
+		return
+	}
+	next := map[string]*tenant{}
+	for _, t := range cfg.tenants() {
+		next[t.name] = t
+		r.redactor.Add(t.cfg.APIToken)
+	}
+	for _, t := range r.tenants {
+		n, ok := next[t.name]
+		if !ok {
+			log.Warnf("Tenant %s removed from the configuration, restart the webhook to stop serving it", t.name)
+			continue
+		}
+		delete(next, t.name)
+		if err = t.reload(n.cfg); err != nil {
+			log.Errorf("Rejected configuration reload of tenant %s, keeping its current configuration: %v", t.name, err)
+			continue
+		}
+		for _, key := range t.cfg.restartRequired(n.cfg) {
+			log.Warnf("Configuration %s of tenant %s changed, restart the webhook to apply it", key, t.name)
+		}
+	}
+	for name := range next {
+		log.Warnf("Tenant %s added to the configuration, restart the webhook to serve it", name)
+	}
+	if err = setupLogging(cfg.LogLevel, cfg.LogFormat, r.redactor); err != nil {
+		log.Errorf("Failed to reload logging: %v", err)
+	}
+	log.Info("Configuration reloaded")
+}
+
+// setupLogging applies log.level and log.format ("text", "json", "auto" is text), every
+// line goes through the redactor, including the SDK debug output of the standard log package.
+func setupLogging(level, format string, redactor *gcoreprovider.Redactor) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("log.level: %w", err)
+	}
+	var formatter log.Formatter
+	switch format {
+	case ``, `auto`, `text`:
+		formatter = &log.TextFormatter{}
+	case `json`:
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("log.format: unknown format %q, expected text or json", format)
+	}
+	log.SetLevel(lvl)
+	log.SetFormatter(gcoreprovider.NewRedactingFormatter(formatter, redactor))
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.StandardLogger().WriterLevel(log.DebugLevel))
+	return nil
+}
+
+// webServer is the webhook API listener and the health and metrics listener
 type webServer struct {
-	*http.Server
+	servers []*http.Server
+	// reload is called on SIGHUP, without it SIGHUP shuts down like SIGTERM
+	reload func()
+	// stopBackground stops the certificate reloading
+	stopBackground context.CancelFunc
 }
 
 func (w *webServer) Start() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	sig := <-sigCh
+	for sig == syscall.SIGHUP && w.reload != nil {
+		log.Info("reloading configuration due to received signal: hangup")
+		w.reload()
+		sig = <-sigCh
+	}
 	log.Printf("shutting down server due to received signal: %v", sig)
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	if err := w.Shutdown(ctx); err != nil {
-		log.Printf("error shutting down server: %v", err)
+	for _, srv := range w.servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("error shutting down server on addr '%s': %v", srv.Addr, err)
+		}
 	}
 	cancel()
+	if w.stopBackground != nil {
+		w.stopBackground()
+	}
 }
 
-// CreateWebServer will respond to the following endpoints:
+// serve starts a listener on addr, it serves HTTPS when tlsConfig is set
+func (w *webServer) serve(addr string, handler http.Handler, tlsConfig *tls.Config) {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	w.servers = append(w.servers, srv)
+	go func() {
+		log.Printf("starting server on addr: '%s' , tls: %t", srv.Addr, tlsConfig != nil)
+		listen := srv.ListenAndServe
+		if tlsConfig != nil {
+			listen = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if err := listen(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("can't serve on addr: '%s', error: %v", srv.Addr, err)
+		}
+	}()
+}
+
+// CreateWebServer starts the webhook API on server.host:server.port and
+// health and metrics on health.host:health.port. The configuration of the
+// listeners is taken from the first tenant, they all share it. The webhook API
+// is served over HTTPS when server.tls is configured, health stays plain HTTP
+// for the kubelet probes.
+//
+// The health listener responds to:
+// - /health (GET): liveness, the process serves requests
+// - /ready (GET): readiness, the Gcore API accepts the token and records are fresh
+// - /tenants/{name}/ready (GET): readiness of a single tenant
+// - /metrics (GET): Prometheus metrics
+//
+// The webhook listener serves the routes of webhookRoutes at / for the top-level
+// configuration and at /tenants/{name}/ for every tenant.
+func CreateWebServer(tenants []*tenant, gatherer prometheus.Gatherer) (*webServer, error) {
+	cfg := tenants[0].cfg
+	var tlsConfig *tls.Config
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.ServerTLS.CertFile != "" {
+		reloader, err := newTLSReloader(cfg.ServerTLS)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go reloader.watch(ctx)
+		tlsConfig = reloader.serverConfig()
+		log.Infof("webhook listener TLS: cert=%s , clientCA=%q , reloadInterval=%s",
+			cfg.ServerTLS.CertFile, cfg.ServerTLS.ClientCAFile, cfg.ServerTLS.ReloadInterval)
+	}
+	if !cfg.ServerAuth.enabled() && !loopbackHost(cfg.ServerHost) {
+		log.Warnf("webhook listener on %q accepts unauthenticated requests, set WEBHOOK_AUTH_TOKEN or WEBHOOK_HMAC_SECRET",
+			cfg.ServerHost)
+	}
+	srv := &webServer{stopBackground: cancel}
+	srv.serve(net.JoinHostPort(cfg.HealthHost, strconv.Itoa(cfg.HealthPort)), healthHandler(tenants, gatherer), nil)
+	srv.serve(net.JoinHostPort(cfg.ServerHost, strconv.Itoa(cfg.ServerPort)), webhookHandler(tenants), tlsConfig)
+	return srv, nil
+}
+
+// healthHandler serves health, readiness and metrics. Without tenants /ready reports the
+// top-level provider, with tenants it reports all of them by name. Requests are counted in
+// the metrics of the top-level provider, with tenants they belong to none and aren't counted.
+func healthHandler(tenants []*tenant, gatherer prometheus.Gatherer) http.Handler {
+	single := len(tenants) == 1 && tenants[0].name == defaultTenant
+	h := chi.NewRouter()
+	if single {
+		h.Use(metricsMiddleware(tenants[0].metrics))
+	}
+	h.Use(recoverMiddleware)
+	h.Handle(`/metrics`, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	h.Get(`/health`, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h.Get(`/ready`, func(w http.ResponseWriter, r *http.Request) {
+		if single {
+			report := tenants[0].provider.Readiness(r.Context())
+			status := http.StatusOK
+			if !report.Ready {
+				status = http.StatusServiceUnavailable
+			}
+			writeJSON(w, r, status, report)
+			return
+		}
+		status, reports := readiness(r.Context(), tenants)
+		writeJSON(w, r, status, reports)
+	})
+	for _, t := range tenants {
+		if t.name == defaultTenant {
+			continue
+		}
+		p := t.provider
+		h.Get(t.prefix()+`/ready`, func(w http.ResponseWriter, r *http.Request) {
+			report := p.Readiness(r.Context())
+			status := http.StatusOK
+			if !report.Ready {
+				status = http.StatusServiceUnavailable
+			}
+			writeJSON(w, r, status, report)
+		})
+	}
+	return h
+}
+
+// webhookHandler serves the webhook routes of every tenant under its prefix,
+// requests are authenticated once the route is known, unknown routes get 404.
+func webhookHandler(tenants []*tenant) http.Handler {
+	r := chi.NewRouter()
+	r.Use(requestIDMiddleware, accessLogMiddleware, tracingMiddleware)
+	for _, t := range tenants {
+		t := t
+		routes := func(r chi.Router) {
+			r.Use(metricsMiddleware(t.metrics), recoverMiddleware, authMiddleware(t.cfg.ServerAuth))
+			webhookRoutes(r, t.cfg, t.provider)
+		}
+		if t.name == defaultTenant {
+			r.Group(routes)
+			continue
+		}
+		r.Route(t.prefix(), routes)
+	}
+	return r
+}
+
+// webhookRoutes adds the webhook API of p to r:
 // - / (GET): initialization, negotiates headers and returns the domain filter
 // - /records (GET): returns the current records
 // - /records (POST): applies the changes
 // - /adjustendpoints (POST): executes the AdjustEndpoints method
-func CreateWebServer(p *gcoreprovider.DnsProvider) *webServer {
-
-	r := chi.NewRouter()
-	r.Get(`/health`, func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+// - /debug/applyqueue (GET): zones locked by running applies and waiting applies count
+// - /dryrun/plan (GET): RRSet operations planned by the latest apply in dry-run mode
+// - /admin/snapshots (GET, POST): lists or takes zone snapshots
+// - /admin/snapshots/{name}/restore (POST): restores a zone from a snapshot
+// - /admin/journal (GET): recent applies
+// - /admin/journal/{id}/undo (POST): reverts an apply
+func webhookRoutes(r chi.Router, cfg Config, p *gcoreprovider.DnsProvider) {
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) { // negotiate
 		requestLog(r).Debug("GET /")
 		if err := acceptHeaderCheck(w, r); err != nil {
 			requestLog(r).WithField(logFieldError, err).Error("accept header check failed")
 			return
 		}
-		b, err := p.GetDomainFilter().MarshalJSON()
+		b, err := p.DomainFilterContext(r.Context()).MarshalJSON()
 		if err != nil {
 			log.Errorf("failed to marshal domain filter, request method: %s, request path: %s", r.Method, r.URL.Path)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -105,8 +427,6 @@ func CreateWebServer(p *gcoreprovider.DnsProvider) *webServer {
 		w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
 		if _, writeError := w.Write(b); writeError != nil {
 			requestLog(r).WithField(logFieldError, writeError).Error("error writing response")
-			w.WriteHeader(http.StatusInternalServerError)
-			return
 		}
 	})
 	r.Get("/records", func(w http.ResponseWriter, r *http.Request) {
@@ -149,7 +469,7 @@ func CreateWebServer(p *gcoreprovider.DnsProvider) *webServer {
 			w.WriteHeader(http.StatusBadRequest)
 			errMsg := fmt.Sprintf("error decoding changes: %s", err.Error())
 			if _, writeError := fmt.Fprint(w, errMsg); writeError != nil {
-				requestLog(r).WithField(logFieldError, writeError).Fatalf("error writing error message to response writer")
+				requestLog(r).WithField(logFieldError, writeError).Error("error writing error message to response writer")
 			}
 			requestLog(r).WithField(logFieldError, err).Info(errMsg)
 			return
@@ -169,7 +489,12 @@ func CreateWebServer(p *gcoreprovider.DnsProvider) *webServer {
 			requestLog(r).Debug("detail for delete: ", changes.Delete)
 		}
 		if err := p.ApplyChanges(ctx, &changes); err != nil {
+			requestLog(r).WithField(logFieldError, err).Error("error applying changes")
 			w.Header().Set(contentTypeHeader, contentTypePlaintext)
+			if errors.Is(err, gcoreprovider.ErrApplyQueueFull) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -193,7 +518,7 @@ func CreateWebServer(p *gcoreprovider.DnsProvider) *webServer {
 			errMessage := fmt.Sprintf("failed to decode request body: %v", err)
 			log.Infof(errMessage+" , request method: %s, request path: %s", r.Method, r.URL.Path)
 			if _, writeError := fmt.Fprint(w, errMessage); writeError != nil {
-				requestLog(r).WithField(logFieldError, writeError).Fatalf("error writing error message to response writer")
+				requestLog(r).WithField(logFieldError, writeError).Error("error writing error message to response writer")
 			}
 			return
 		}
@@ -204,22 +529,89 @@ func CreateWebServer(p *gcoreprovider.DnsProvider) *webServer {
 		w.Header().Set(contentTypeHeader, string(mediaTypeVersion1))
 		w.Header().Set(varyHeader, contentTypeHeader)
 		if _, writeError := fmt.Fprint(w, string(out)); writeError != nil {
-			requestLog(r).WithField(logFieldError, writeError).Fatalf("error writing response")
+			requestLog(r).WithField(logFieldError, writeError).Error("error writing response")
 		}
 	})
 
-	srv := &webServer{
-		Server: &http.Server{
-			Addr:    fmt.Sprintf("%s:%s", ServerHost, ServerPort),
-			Handler: r,
-		}}
-	go func() {
-		log.Printf("starting server on addr: '%s' ", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("can't serve on addr: '%s', error: %v", srv.Addr, err)
+	r.Get("/debug/applyqueue", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentTypeHeader, "application/json")
+		if err := json.NewEncoder(w).Encode(p.ApplyQueueDepth()); err != nil {
+			requestLog(r).WithField(logFieldError, err).Error("error encoding apply queue")
 		}
-	}()
-	return srv
+	})
+
+	r.Get("/dryrun/plan", func(w http.ResponseWriter, r *http.Request) {
+		plan := p.LastDryRunPlan()
+		if plan == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set(contentTypeHeader, "application/json")
+		if err := json.NewEncoder(w).Encode(plan); err != nil {
+			requestLog(r).WithField(logFieldError, err).Error("error encoding dry-run plan")
+		}
+	})
+
+	r.Get("/admin/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		infos, err := p.Snapshots()
+		if err != nil {
+			snapshotError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, infos)
+	})
+
+	r.Post("/admin/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		info, err := p.SaveSnapshot(ctx, r.URL.Query()["zone"], "manual")
+		if err != nil {
+			snapshotError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusCreated, info)
+	})
+
+	r.Post("/admin/snapshots/{name}/restore", func(w http.ResponseWriter, r *http.Request) {
+		zone := r.URL.Query().Get("zone")
+		if zone == "" {
+			http.Error(w, "zone query parameter is required", http.StatusBadRequest)
+			return
+		}
+		ctx := r.Context()
+		dryRun := cfg.DryRun || r.URL.Query().Get("dryRun") == "true"
+		ops, err := p.RestoreSnapshot(ctx, chi.URLParam(r, "name"), zone, dryRun)
+		if err != nil {
+			snapshotError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, ops)
+	})
+
+	r.Get("/admin/journal", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := p.Journal()
+		if err != nil {
+			journalError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, entries)
+	})
+
+	r.Post("/admin/journal/{id}/undo", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid journal entry id", http.StatusBadRequest)
+			return
+		}
+		ctx := r.Context()
+		dryRun := cfg.DryRun || r.URL.Query().Get("dryRun") == "true"
+		ops, err := p.Undo(ctx, id, dryRun)
+		if err != nil {
+			journalError(w, r, err)
+			return
+		}
+		writeJSON(w, r, http.StatusOK, ops)
+	})
+
 }
 
 const (
@@ -232,8 +624,82 @@ const (
 	logFieldRequestPath    = "requestPath"
 	logFieldRequestMethod  = "requestMethod"
 	logFieldError          = "error"
+	logFieldRequestID      = "requestId"
+	logFieldStatus         = "status"
+	logFieldBytes          = "bytes"
+	logFieldDuration       = "duration"
+	logFieldRemote         = "remoteAddr"
+	requestIDHeader        = "X-Request-Id"
 )
 
+// metricsMiddleware counts requests and their latency per route pattern
+func metricsMiddleware(metrics *gcoreprovider.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			started := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			metrics.ObserveRequest(route, r.Method, status, time.Since(started))
+		})
+	}
+}
+
+// tracingMiddleware starts a server span per request, continuing the incoming
+// trace context, and names it after the route pattern once it is known.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if route := chi.RouteContext(r.Context()).RoutePattern(); route != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+	}), "webhook")
+}
+
+// snapshotError maps snapshot errors to HTTP statuses
+func snapshotError(w http.ResponseWriter, r *http.Request, err error) {
+	requestLog(r).WithField(logFieldError, err).Error("snapshot request failed")
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gcoreprovider.ErrSnapshotNotFound), errors.Is(err, gcoreprovider.ErrSnapshotsDisabled):
+		status = http.StatusNotFound
+	case errors.Is(err, gcoreprovider.ErrProtectedRecord), errors.Is(err, gcoreprovider.ErrDeletionLimit):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// journalError maps journal errors to HTTP statuses
+func journalError(w http.ResponseWriter, r *http.Request, err error) {
+	requestLog(r).WithField(logFieldError, err).Error("journal request failed")
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gcoreprovider.ErrJournalEntryNotFound), errors.Is(err, gcoreprovider.ErrJournalDisabled):
+		status = http.StatusNotFound
+	case errors.Is(err, gcoreprovider.ErrJournalConflict), errors.Is(err, gcoreprovider.ErrProtectedRecord),
+		errors.Is(err, gcoreprovider.ErrDeletionLimit):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set(contentTypeHeader, "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		requestLog(r).WithField(logFieldError, err).Error("error encoding response")
+	}
+}
+
 func contentTypeHeaderCheck(w http.ResponseWriter, r *http.Request) error {
 	return headerCheck(true, w, r)
 }
@@ -261,7 +727,7 @@ func headerCheck(isContentType bool, w http.ResponseWriter, r *http.Request) err
 		err := fmt.Errorf(msg)
 		_, writeErr := fmt.Fprint(w, err.Error())
 		if writeErr != nil {
-			requestLog(r).WithField(logFieldError, writeErr).Fatalf("error writing error message to response writer")
+			requestLog(r).WithField(logFieldError, writeErr).Error("error writing error message to response writer")
 		}
 		return err
 	}
@@ -278,15 +744,79 @@ func headerCheck(isContentType bool, w http.ResponseWriter, r *http.Request) err
 		err := fmt.Errorf(msg+": %s", err.Error())
 		_, writeErr := fmt.Fprint(w, err.Error())
 		if writeErr != nil {
-			requestLog(r).WithField(logFieldError, writeErr).Fatalf("error writing error message to response writer")
+			requestLog(r).WithField(logFieldError, writeErr).Error("error writing error message to response writer")
 		}
 		return err
 	}
 	return nil
 }
 
+// requestID takes the ID set by the caller or generates a new one
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != `` {
+		return id
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDMiddleware puts the request ID into the context for provider logs and
+// the audit log, and returns it to the caller.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(gcoreprovider.WithRequestID(r.Context(), id)))
+	})
+}
+
+// accessLogMiddleware logs every request with its status and duration
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requestLog(r).WithFields(log.Fields{
+			logFieldStatus:   status,
+			logFieldBytes:    ww.BytesWritten(),
+			logFieldDuration: time.Since(started).String(),
+			logFieldRemote:   r.RemoteAddr,
+		}).Info("request served")
+	})
+}
+
+// recoverMiddleware turns a panic in a handler into a 500 instead of killing the process
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			requestLog(r).WithFields(log.Fields{
+				logFieldError: fmt.Sprint(rec),
+				"stack":       string(debug.Stack()),
+			}).Error("panic serving request")
+			w.WriteHeader(http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
 func requestLog(r *http.Request) *log.Entry {
-	return log.WithFields(log.Fields{logFieldRequestMethod: r.Method, logFieldRequestPath: r.URL.Path})
+	fields := log.Fields{logFieldRequestMethod: r.Method, logFieldRequestPath: r.URL.Path}
+	if id := gcoreprovider.RequestID(r.Context()); id != `` {
+		fields[logFieldRequestID] = id
+	}
+	return log.WithFields(fields)
 }
 
 var mediaTypeVersion1 = mediaTypeVersion("1")
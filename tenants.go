@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/G-Core/external-dns-gcore-webhook/gcoreprovider"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// defaultTenant is the provider of the top-level configuration, served at /
+	defaultTenant     = "default"
+	tenantsPrefix     = "/tenants/"
+	tenantMetricLabel = "tenant"
+)
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// tenantConfig is an entry of the tenants list, other settings are taken from the top level
+type tenantConfig struct {
+	Name         string           `yaml:"name"`
+	APIURL       string           `yaml:"apiUrl,omitempty"`
+	APIToken     string           `yaml:"apiToken,omitempty"`
+	APITokenFile string           `yaml:"apiTokenFile,omitempty"`
+	DomainFilter []string         `yaml:"domainFilter,omitempty"`
+	DryRun       bool             `yaml:"dryRun,omitempty"`
+	Protection   tenantProtection `yaml:"protection,omitempty"`
+}
+
+type tenantProtection struct {
+	Records []string `yaml:"records,omitempty"`
+	Refuse  bool     `yaml:"refuse,omitempty"`
+	Hide    bool     `yaml:"hide,omitempty"`
+}
+
+// tenantsValue is set from a YAML or JSON list, tokens are masked when printed
+type tenantsValue []tenantConfig
+
+func (v *tenantsValue) Set(s string) error {
+	tenants := make([]tenantConfig, 0)
+	if err := yaml.UnmarshalStrict([]byte(s), &tenants); err != nil {
+		return fmt.Errorf("not a list of tenants: %w", err)
+	}
+	*v = tenants
+	return nil
+}
+func (v *tenantsValue) String() string {
+	if len(*v) == 0 {
+		return ""
+	}
+	bs, _ := yaml.Marshal([]tenantConfig(*v))
+	return string(bs)
+}
+func (v *tenantsValue) yaml() interface{} {
+	res := make([]tenantConfig, 0, len(*v))
+	for _, t := range *v {
+		if t.APIToken != "" {
+			t.APIToken = maskedSecret
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+func (c *Config) validateTenants() []error {
+	errs := make([]error, 0)
+	names := map[string]bool{defaultTenant: true}
+	for i, t := range c.Tenants {
+		if !tenantNamePattern.MatchString(t.Name) || names[t.Name] {
+			errs = append(errs, fmt.Errorf("tenants[%d]: name %q is not a unique lowercase DNS label other than %s",
+				i, t.Name, defaultTenant))
+		}
+		names[t.Name] = true
+		if (t.APIToken == "") == (t.APITokenFile == "") {
+			errs = append(errs, fmt.Errorf("tenants[%d]: exactly one of apiToken and apiTokenFile is required", i))
+		}
+		if _, err := gcoreprovider.NewProtectionRules(t.Protection.Records); err != nil {
+			errs = append(errs, fmt.Errorf("tenants[%d].protection.records: %w", i, err))
+		}
+	}
+	return append(errs, c.validateTenantDomains()...)
+}
+
+// validateTenantDomains rejects tenants which could change the same zone, each of them would
+// lock and cache it on its own. An empty domain filter takes every zone.
+func (c *Config) validateTenantDomains() []error {
+	errs := make([]error, 0)
+	names := make([]string, 0, len(c.Tenants)+1)
+	filters := make([][]string, 0, len(c.Tenants)+1)
+	if c.hasCredentials() && len(c.Tenants) > 0 {
+		names, filters = append(names, defaultTenant), append(filters, c.DomainFilter)
+	}
+	for _, t := range c.Tenants {
+		names, filters = append(names, t.Name), append(filters, t.DomainFilter)
+	}
+	for i := range filters {
+		for j := i + 1; j < len(filters); j++ {
+			if domain, ok := overlap(filters[i], filters[j]); ok {
+				errs = append(errs, fmt.Errorf("tenants %s and %s both manage %s, domain filters must not overlap",
+					names[i], names[j], domain))
+			}
+		}
+	}
+	return errs
+}
+
+// overlap finds a domain both filters select, it tells "*" when one of them is empty
+func overlap(a, b []string) (string, bool) {
+	if len(a) == 0 || len(b) == 0 {
+		return "*", true
+	}
+	for _, x := range a {
+		x = normalizeDomain(x)
+		for _, y := range b {
+			y = normalizeDomain(y)
+			switch {
+			case x == y, strings.HasSuffix(x, "."+y):
+				return x, true
+			case strings.HasSuffix(y, "."+x):
+				return y, true
+			}
+		}
+	}
+	return "", false
+}
+
+func normalizeDomain(d string) string {
+	return strings.Trim(strings.ToLower(strings.TrimSpace(d)), ".")
+}
+
+// hasCredentials tells if the top-level configuration is a provider of its own
+func (c *Config) hasCredentials() bool {
+	return c.APIToken != "" || c.APITokenFile != "" || c.APITokenCommand != "" || len(c.Accounts) > 0
+}
+
+// forTenant is the configuration of tenant t: its credentials, domain filter, dry-run and
+// protection replace the top-level ones, files of the state kept per provider get the tenant name.
+// The top-level dry-run applies to every tenant.
+func (c *Config) forTenant(t tenantConfig) Config {
+	res := *c
+	res.Tenants = nil
+	res.Accounts = nil
+	res.APIToken, res.APITokenFile, res.APITokenCommand = t.APIToken, t.APITokenFile, ""
+	if t.APIURL != "" {
+		res.APIURL = t.APIURL
+	}
+	res.DomainFilter = t.DomainFilter
+	res.DryRun = c.DryRun || t.DryRun
+	res.ProtectedRecords, res.ProtectedRefuse, res.ProtectedHide = t.Protection.Records, t.Protection.Refuse, t.Protection.Hide
+	res.SoftDeleteState = tenantPath(c.SoftDeleteState, t.Name)
+	res.AuditLog = tenantPath(c.AuditLog, t.Name)
+	res.DryRunPlanFile = tenantPath(c.DryRunPlanFile, t.Name)
+	res.JournalFile = tenantPath(c.JournalFile, t.Name)
+	if c.SnapshotDir != "" {
+		res.SnapshotDir = filepath.Join(c.SnapshotDir, t.Name)
+	}
+	return res
+}
+
+// tenantPath keeps the files of tenants apart: "/data/journal.json" becomes "/data/journal-a.json"
+func tenantPath(path, name string) string {
+	if path == "" || path == "-" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// tenant is a provider with its own configuration, metrics and routes
+type tenant struct {
+	name     string
+	cfg      Config
+	provider *gcoreprovider.DnsProvider
+	metrics  *gcoreprovider.Metrics
+}
+
+// tenants lists the providers to serve, the top-level one first when it has credentials
+func (c *Config) tenants() []*tenant {
+	res := make([]*tenant, 0, len(c.Tenants)+1)
+	if c.hasCredentials() {
+		res = append(res, &tenant{name: defaultTenant, cfg: *c})
+	}
+	for _, t := range c.Tenants {
+		res = append(res, &tenant{name: t.Name, cfg: c.forTenant(t)})
+	}
+	return res
+}
+
+// prefix is the path the webhook routes of t are served under
+func (t *tenant) prefix() string {
+	if t.name == defaultTenant {
+		return "/"
+	}
+	return tenantsPrefix + t.name
+}
+
+// start creates the provider of t, its metrics are labeled with the tenant when labeled is set
+func (t *tenant) start(ctx context.Context, registry prometheus.Registerer, labeled bool,
+	redactor *gcoreprovider.Redactor) error {
+	opts, err := providerOptions(t.cfg)
+	if err != nil {
+		return err
+	}
+	if labeled {
+		registry = prometheus.WrapRegistererWith(prometheus.Labels{tenantMetricLabel: t.name}, registry)
+	}
+	if t.metrics, err = gcoreprovider.NewMetrics(registry); err != nil {
+		return fmt.Errorf("register metrics: %w", err)
+	}
+	opts = append(opts, gcoreprovider.WithMetrics(t.metrics), gcoreprovider.WithRedactor(redactor))
+	redactor.Add(t.cfg.APIToken)
+	domainFilter := endpoint.NewDomainFilter(t.cfg.DomainFilter)
+	if t.provider, err = gcoreprovider.NewProvider(domainFilter, t.cfg.APIURL, t.cfg.APIToken, t.cfg.DryRun, opts...); err != nil {
+		return err
+	}
+	return t.provider.CheckSelfTest(ctx, t.cfg.SelfTest)
+}
+
+// reload applies cfg to the running provider of t and keeps its reloadable settings
+func (t *tenant) reload(cfg Config) error {
+	opts, err := providerOptions(cfg)
+	if err != nil {
+		return err
+	}
+	if err = t.provider.Reload(endpoint.NewDomainFilter(cfg.DomainFilter), cfg.APIToken, opts...); err != nil {
+		return err
+	}
+	t.cfg.applyReloadable(cfg)
+	return nil
+}
+
+// readiness reports every tenant by name, ready only when all of them are
+func readiness(ctx context.Context, tenants []*tenant) (int, map[string]gcoreprovider.ReadinessReport) {
+	status := http.StatusOK
+	reports := make(map[string]gcoreprovider.ReadinessReport, len(tenants))
+	for _, t := range tenants {
+		report := t.provider.Readiness(ctx)
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		reports[t.name] = report
+	}
+	return status, reports
+}
+
+func logTenants(tenants []*tenant) {
+	for _, t := range tenants {
+		log.Infof("serving tenant %s at %s, domain filter: %v, dry-run: %t", t.name, t.prefix(), t.cfg.DomainFilter, t.cfg.DryRun)
+	}
+}
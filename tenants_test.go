@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/G-Core/external-dns-gcore-webhook/gcoreprovider"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestConfig_tenants(t *testing.T) {
+	file := writeConfigFile(t, `
+gcore:
+  apiToken: top-token
+domainFilter: [example.com]
+journal:
+  file: /data/journal.json
+snapshots:
+  dir: /data/snapshots
+tenants:
+  - name: team-a
+    apiToken: a-token
+    domainFilter: [team-a.com]
+    dryRun: true
+    protection:
+      records: ["*/MX"]
+`)
+	cfg, _, err := loadConfig([]string{"--config", file}, envMap(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := cfg.tenants()
+	if len(tenants) != 2 || tenants[0].name != defaultTenant || tenants[0].prefix() != "/" {
+		t.Fatalf("tenants() = %+v", tenants)
+	}
+	a := tenants[1].cfg
+	if tenants[1].prefix() != "/tenants/team-a" || a.APIToken != "a-token" || !a.DryRun ||
+		strings.Join(a.DomainFilter, ",") != "team-a.com" || strings.Join(a.ProtectedRecords, ",") != "*/MX" {
+		t.Errorf("tenant configuration = %+v", a)
+	}
+	if a.JournalFile != "/data/journal-team-a.json" || a.SnapshotDir != "/data/snapshots/team-a" || a.ServerPort != cfg.ServerPort {
+		t.Errorf("tenant files = %s, %s", a.JournalFile, a.SnapshotDir)
+	}
+
+	env := map[string]string{"TENANTS": `[{name: Team, apiToken: x}, {name: b, apiToken: x, apiTokenFile: /y}]`}
+	_, _, err = loadConfig(nil, envMap(env), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), `tenants[0]: name "Team"`) ||
+		!strings.Contains(err.Error(), "tenants[1]: exactly one of apiToken and apiTokenFile") {
+		t.Errorf("loadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"GCORE_PERMANENT_API_TOKEN": "x", "DOMAIN_FILTER": "example.com",
+			"TENANTS": `[{name: a, apiToken: y, domainFilter: [a.example.com]}]`}, "tenants default and a both manage a.example.com"},
+		{map[string]string{"TENANTS": `[{name: a, apiToken: x, domainFilter: [Example.com.]}, {name: b, apiToken: y, domainFilter: [example.com]}]`},
+			"tenants a and b both manage example.com"},
+		{map[string]string{"TENANTS": `[{name: a, apiToken: x}, {name: b, apiToken: y, domainFilter: [b.com]}]`},
+			"tenants a and b both manage *"},
+		{map[string]string{"TENANTS": `[{name: a, apiToken: x, domainFilter: [a.com]}, {name: b, apiToken: y, domainFilter: [b.com, ba.com]}]`}, ""},
+	}
+	for _, tt := range tests {
+		_, _, err = loadConfig(nil, envMap(tt.env), io.Discard)
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("loadConfig(%v) error = %v, want %q", tt.env, err, tt.want)
+		}
+	}
+}
+
+func TestWebhookHandler_tenants(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer api.Close()
+	env := map[string]string{
+		"GCORE_API_URL": api.URL,
+		"TENANTS":       `[{name: team-a, apiToken: a-token, domainFilter: [a.com]}, {name: team-b, apiToken: b-token, domainFilter: [b.com]}]`,
+	}
+	cfg, _, err := loadConfig(nil, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := cfg.tenants()
+	registry := prometheus.NewRegistry()
+	for _, tn := range tenants {
+		if err = tn.start(context.Background(), registry, true, gcoreprovider.NewRedactor()); err != nil {
+			t.Fatal(err)
+		}
+		defer tn.provider.Close()
+	}
+	srv := httptest.NewServer(webhookHandler(tenants))
+	defer srv.Close()
+	for path, want := range map[string]string{"/tenants/team-a/": "a.com", "/tenants/team-b/": "b.com"} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set(acceptHeader, string(mediaTypeVersion1))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("GET %s = %d %s, want %s", path, resp.StatusCode, body, want)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /records without a top-level provider = %d", resp.StatusCode)
+	}
+	if n := testutil.CollectAndCount(registry, "gcore_webhook_http_requests_total"); n != 2 {
+		t.Errorf("request metrics per tenant = %d, want 2", n)
+	}
+	health := httptest.NewServer(healthHandler(tenants, registry))
+	defer health.Close()
+	for _, path := range []string{"/health", "/tenants/team-a/ready"} {
+		if resp, err = http.Get(health.URL + path); err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s = %d", path, resp.StatusCode)
+		}
+	}
+	if n := testutil.CollectAndCount(registry, "gcore_webhook_http_requests_total"); n != 2 {
+		t.Errorf("health requests counted in the metrics of a tenant, series = %d", n)
+	}
+
+	// a reload keeps the reloadable settings of the tenant
+	env["TENANTS"] = `[{name: team-a, apiToken: a-token, domainFilter: [c.com]}]`
+	next, _, err := loadConfig(nil, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tenants[0].reload(next.tenants()[0].cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := tenants[0].cfg.DomainFilter; len(got) != 1 || got[0] != "c.com" {
+		t.Errorf("domain filter after reload = %v, want c.com", got)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// listenerTLS configures TLS of the webhook listener, ClientCAFile makes it require client certificates
+type listenerTLS struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// ReloadInterval is how often the files are checked for changes, 0 disables reloading
+	ReloadInterval time.Duration
+}
+
+// tlsReloader serves the certificate and client CAs of the files it was created with and
+// loads them again when they change, e.g. after cert-manager renewed a Secret volume.
+// A failed load keeps the previous certificate.
+type tlsReloader struct {
+	cfg    listenerTLS
+	mu     sync.RWMutex
+	config *tls.Config
+	// stamp is the modification time and size of the files the config was loaded from
+	stamp string
+}
+
+func newTLSReloader(cfg listenerTLS) (*tlsReloader, error) {
+	r := &tlsReloader{cfg: cfg}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// serverConfig is the configuration of the listener, every handshake takes the latest loaded one.
+// GetCertificate is set as well, so the listener counts as having a certificate without files.
+func (r *tlsReloader) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &r.current().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+func (r *tlsReloader) current() *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+func (r *tlsReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// fileStamp changes whenever one of the files is replaced, Stat follows the symlinks of Secret volumes
+func (r *tlsReloader) fileStamp() (string, error) {
+	parts := make([]string, 0, 3)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size()))
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// reload loads the files when they changed since the last attempt
+func (r *tlsReloader) reload() error {
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return fmt.Errorf("webhook TLS: %w", err)
+	}
+	r.mu.RLock()
+	unchanged := stamp == r.stamp
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	config, err := r.load()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stamp = stamp
+	if err != nil {
+		return fmt.Errorf("webhook TLS: %w", err)
+	}
+	r.config = config
+	return nil
+}
+
+func (r *tlsReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if r.cfg.ClientCAFile == "" {
+		return config, nil
+	}
+	bs, err := os.ReadFile(r.cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bs) {
+		return nil, errors.New("no certificates in client CA file " + r.cfg.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config, nil
+}
+
+// watch reloads the files every ReloadInterval until ctx is done
+func (r *tlsReloader) watch(ctx context.Context) {
+	if r.cfg.ReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.mu.RLock()
+		previous := r.config
+		r.mu.RUnlock()
+		if err := r.reload(); err != nil {
+			log.Errorf("Failed to reload the certificate, keeping the current one: %v", err)
+			continue
+		}
+		r.mu.RLock()
+		changed := r.config != previous
+		r.mu.RUnlock()
+		if changed {
+			log.Infof("reloaded TLS certificate of the webhook listener from %s", r.cfg.CertFile)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/G-Core/external-dns-gcore-webhook/gcoreprovider"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testCert issues a certificate for localhost signed by ca, a self-signed CA when ca is nil
+func testCert(t *testing.T, ca *tls.Certificate, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parent, signer := tmpl, any(key)
+	if ca == nil {
+		tmpl.IsCA, tmpl.KeyUsage, tmpl.BasicConstraintsValid = true, x509.KeyUsageCertSign, true
+	} else {
+		parent, signer = ca.Leaf, ca.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, cert tls.Certificate, certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	if err = os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+		if err = os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := listenerTLS{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	ca := testCert(t, nil, "ca")
+	writePEM(t, ca, cfg.ClientCAFile, "")
+	writePEM(t, testCert(t, &ca, "server-1"), cfg.CertFile, cfg.KeyFile)
+	reloader, err := newTLSReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = reloader.serverConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	client := testCert(t, &ca, "external-dns")
+	get := func(certs ...tls.Certificate) (string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		_ = resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+	if _, err = get(); err == nil {
+		t.Error("request without a client certificate must fail")
+	}
+	if _, err = get(testCert(t, nil, "stranger")); err == nil {
+		t.Error("request with a certificate of another CA must fail")
+	}
+	if name, err := get(client); err != nil || name != "server-1" {
+		t.Fatalf("served certificate = %s, %v", name, err)
+	}
+
+	writePEM(t, testCert(t, &ca, "server-2"), cfg.CertFile, cfg.KeyFile)
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(cfg.CertFile, later, later)
+	if err = reloader.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := get(client); err != nil || name != "server-2" {
+		t.Errorf("served certificate after reload = %s, %v", name, err)
+	}
+
+	if err = os.WriteFile(cfg.KeyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(cfg.KeyFile, later.Add(time.Minute), later.Add(time.Minute))
+	if err = reloader.reload(); err == nil {
+		t.Error("reload() of a broken key must fail")
+	}
+	if name, err := get(client); err != nil || name != "server-2" {
+		t.Errorf("served certificate after a failed reload = %s, %v", name, err)
+	}
+}
+
+// freePort returns a port nothing listens on right now
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestCreateWebServer_tls(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"zones":[]}`))
+	}))
+	defer api.Close()
+	dir := t.TempDir()
+	ca := testCert(t, nil, "ca")
+	writePEM(t, testCert(t, &ca, "webhook"), filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	port := freePort(t)
+	env := map[string]string{
+		"GCORE_API_URL":             api.URL,
+		"GCORE_PERMANENT_API_TOKEN": "token",
+		"SERVER_HOST":               "127.0.0.1",
+		"SERVER_PORT":               port,
+		"HEALTH_HOST":               "127.0.0.1",
+		"HEALTH_PORT":               freePort(t),
+		"SERVER_TLS_CERT_FILE":      filepath.Join(dir, "tls.crt"),
+		"SERVER_TLS_KEY_FILE":       filepath.Join(dir, "tls.key"),
+	}
+	cfg, _, err := loadConfig(nil, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := cfg.tenants()
+	registry := prometheus.NewRegistry()
+	if err = tenants[0].start(context.Background(), registry, false, gcoreprovider.NewRedactor()); err != nil {
+		t.Fatal(err)
+	}
+	defer tenants[0].provider.Close()
+	srv, err := CreateWebServer(tenants, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, s := range srv.servers {
+			_ = s.Close()
+		}
+		srv.stopBackground()
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	req, _ := http.NewRequest(http.MethodGet, "https://127.0.0.1:"+port+"/", nil)
+	req.Header.Set(acceptHeader, string(mediaTypeVersion1))
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Do(req); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET / over TLS: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS.PeerCertificates[0].Subject.CommonName != "webhook" {
+		t.Errorf("GET / = %d, certificate %s", resp.StatusCode, resp.TLS.PeerCertificates[0].Subject.CommonName)
+	}
+}